@@ -4,17 +4,92 @@ import (
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	ServerPort    string
-	MySQLUser     string
-	MySQLPassword string
-	MySQLHost     string
-	MySQLPort     string
-	MySQLDatabase string
-	JWTSecret     string
-	BodyLimit     string
+	ServerPort      string
+	MySQLUser       string
+	MySQLPassword   string
+	MySQLHost       string
+	MySQLPort       string
+	MySQLDatabase   string
+	JWTSecret       string
+	BodyLimit       string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// Directory of PEM keys for signing access tokens with RS256 or EdDSA,
+	// see package jwtkeys. Tokens are signed with JWTSecret when empty.
+	JWTKeysDir      string
+	JWTSigningKeyID string
+	// How often the background worker checks for blogs due to be published
+	PublishInterval time.Duration
+	// How long deleted blogs stay in the trash, and how often it is purged
+	TrashRetention     time.Duration
+	TrashPurgeInterval time.Duration
+	// Deepest reply level returned by the threaded comment listing
+	CommentMaxDepth int
+	// Outgoing mail. MailDriver is one of "log", "file" (writes to
+	// MailOutboxDir) or "smtp".
+	MailDriver    string
+	MailFrom      string
+	MailOutboxDir string
+	SMTPHost      string
+	SMTPPort      string
+	SMTPUsername  string
+	SMTPPassword  string
+	// Page of the frontend that asks for a new password; the reset token is
+	// appended as the token query parameter.
+	PasswordResetURL string
+	PasswordResetTTL time.Duration
+	// Public base URL of this API, used for links in emails
+	PublicURL            string
+	EmailVerificationTTL time.Duration
+	// Whether creating blogs and comments needs a verified email address
+	RequireVerifiedEmail bool
+	// Per-email login lockout, see service.LockoutPolicy
+	LoginMaxAttempts   int
+	LoginLockoutBase   time.Duration
+	LoginLockoutMax    time.Duration
+	LoginFailureWindow time.Duration
+	// How often failed logins that no longer count are deleted
+	LoginPurgeInterval time.Duration
+	// Two-factor authentication: name shown in authenticator apps and how
+	// long the second login step may take
+	TOTPIssuer  string
+	MFATokenTTL time.Duration
+	// External OpenID Connect login providers, and how long a login at a
+	// provider may take
+	OIDCProviders []OIDCProvider
+	OIDCStateTTL  time.Duration
+	// How long the active state of a session is cached; revoking a session
+	// may take this long to reach other instances
+	SessionCacheTTL time.Duration
+	// Account deletion: "anonymize" keeps the user's comments on other
+	// users' blogs under an anonymized author, "cascade" removes them too.
+	// Deletions are carried out after the grace period.
+	AccountDeletionMode  string
+	AccountDeletionGrace time.Duration
+	AccountPurgeInterval time.Duration
+	// Algorithm for new password hashes, "argon2id" or "bcrypt", and its
+	// cost. Stored hashes with another algorithm or cost are replaced on
+	// the next login.
+	PasswordHasher    string
+	Argon2Memory      int
+	Argon2Iterations  int
+	Argon2Parallelism int
+	BcryptCost        int
+}
+
+// OIDCProvider is one of the providers listed in OIDC_PROVIDERS. The name is
+// part of the login and callback URLs, /auth/oidc/<name>[/callback].
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
 }
 
 func Load(logger *zap.SugaredLogger) *Config {
@@ -22,16 +97,103 @@ func Load(logger *zap.SugaredLogger) *Config {
 	if err := godotenv.Load(); err != nil {
 		logger.Warnw("No .env file found")
 	}
-	return &Config{
-		ServerPort:    getEnv(logger, "SERVER_PORT", "8080"),
-		MySQLUser:     mustGetEnv(logger, "MYSQL_USER"),
-		MySQLPassword: mustGetEnv(logger, "MYSQL_PASSWORD"),
-		MySQLHost:     mustGetEnv(logger, "MYSQL_HOST"),
-		MySQLPort:     getEnv(logger, "MYSQL_PORT", "3306"),
-		MySQLDatabase: mustGetEnv(logger, "MYSQL_DATABASE"),
-		JWTSecret:     mustGetEnv(logger, "JWT_SECRET"),
-		BodyLimit:     getEnv(logger, "BODY_LIMIT", "1M"),
+	cfg := &Config{
+		ServerPort:           getEnv(logger, "SERVER_PORT", "8080"),
+		MySQLUser:            mustGetEnv(logger, "MYSQL_USER"),
+		MySQLPassword:        mustGetEnv(logger, "MYSQL_PASSWORD"),
+		MySQLHost:            mustGetEnv(logger, "MYSQL_HOST"),
+		MySQLPort:            getEnv(logger, "MYSQL_PORT", "3306"),
+		MySQLDatabase:        mustGetEnv(logger, "MYSQL_DATABASE"),
+		JWTSecret:            mustGetEnv(logger, "JWT_SECRET"),
+		JWTKeysDir:           getEnv(logger, "JWT_KEYS_DIR", ""),
+		JWTSigningKeyID:      getEnv(logger, "JWT_SIGNING_KEY_ID", ""),
+		BodyLimit:            getEnv(logger, "BODY_LIMIT", "1M"),
+		AccessTokenTTL:       getDurationEnv(logger, "ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:      getDurationEnv(logger, "REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		PublishInterval:      getDurationEnv(logger, "PUBLISH_INTERVAL", time.Minute),
+		CommentMaxDepth:      getIntEnv(logger, "COMMENT_MAX_DEPTH", 5),
+		TrashRetention:       time.Duration(getIntEnv(logger, "TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour,
+		TrashPurgeInterval:   getDurationEnv(logger, "TRASH_PURGE_INTERVAL", time.Hour),
+		MailDriver:           getEnv(logger, "MAIL_DRIVER", "log"),
+		MailFrom:             getEnv(logger, "MAIL_FROM", "Blog <no-reply@localhost>"),
+		MailOutboxDir:        getEnv(logger, "MAIL_OUTBOX_DIR", ""),
+		SMTPHost:             getEnv(logger, "SMTP_HOST", ""),
+		SMTPPort:             getEnv(logger, "SMTP_PORT", "587"),
+		SMTPUsername:         getEnv(logger, "SMTP_USERNAME", ""),
+		SMTPPassword:         getEnv(logger, "SMTP_PASSWORD", ""),
+		PasswordResetURL:     getEnv(logger, "PASSWORD_RESET_URL", "http://localhost:3000/reset-password"),
+		PasswordResetTTL:     getDurationEnv(logger, "PASSWORD_RESET_TTL", time.Hour),
+		PublicURL:            strings.TrimSuffix(getEnv(logger, "PUBLIC_URL", "http://localhost:8080"), "/"),
+		EmailVerificationTTL: getDurationEnv(logger, "EMAIL_VERIFICATION_TTL", 48*time.Hour),
+		RequireVerifiedEmail: getBoolEnv(logger, "REQUIRE_VERIFIED_EMAIL", false),
+		LoginMaxAttempts:     getIntEnv(logger, "LOGIN_MAX_ATTEMPTS", 5),
+		LoginLockoutBase:     getDurationEnv(logger, "LOGIN_LOCKOUT_BASE", time.Minute),
+		LoginLockoutMax:      getDurationEnv(logger, "LOGIN_LOCKOUT_MAX", time.Hour),
+		LoginFailureWindow:   getDurationEnv(logger, "LOGIN_FAILURE_WINDOW", 24*time.Hour),
+		LoginPurgeInterval:   getDurationEnv(logger, "LOGIN_ATTEMPT_PURGE_INTERVAL", time.Hour),
+		TOTPIssuer:           getEnv(logger, "TOTP_ISSUER", "Blog API"),
+		MFATokenTTL:          getDurationEnv(logger, "MFA_TOKEN_TTL", 5*time.Minute),
+		OIDCProviders:        getOIDCProviders(logger),
+		OIDCStateTTL:         getDurationEnv(logger, "OIDC_STATE_TTL", 10*time.Minute),
+		SessionCacheTTL:      getDurationEnv(logger, "SESSION_CACHE_TTL", 30*time.Second),
+		AccountDeletionMode:  getEnv(logger, "ACCOUNT_DELETION_MODE", "anonymize"),
+		AccountDeletionGrace: time.Duration(getIntEnv(logger, "ACCOUNT_DELETION_GRACE_DAYS", 30)) * 24 * time.Hour,
+		AccountPurgeInterval: getDurationEnv(logger, "ACCOUNT_PURGE_INTERVAL", time.Hour),
+		PasswordHasher:       getEnv(logger, "PASSWORD_HASHER", "argon2id"),
+		Argon2Memory:         getIntEnv(logger, "ARGON2_MEMORY_KIB", 64*1024),
+		Argon2Iterations:     getIntEnv(logger, "ARGON2_ITERATIONS", 3),
+		Argon2Parallelism:    getIntEnv(logger, "ARGON2_PARALLELISM", 2),
+		BcryptCost:           getIntEnv(logger, "BCRYPT_COST", 12),
 	}
+
+	switch {
+	case cfg.MailDriver != "log" && cfg.MailDriver != "file" && cfg.MailDriver != "smtp":
+		logger.Fatalw("MAIL_DRIVER must be one of: log file smtp", "value", cfg.MailDriver)
+	case cfg.MailDriver == "file" && cfg.MailOutboxDir == "":
+		logger.Fatalw("MAIL_OUTBOX_DIR is required with MAIL_DRIVER=file")
+	case cfg.MailDriver == "smtp" && cfg.SMTPHost == "":
+		logger.Fatalw("SMTP_HOST is required with MAIL_DRIVER=smtp")
+	case cfg.TrashRetention < 24*time.Hour:
+		// With no retention blogs would be purged before they could be restored
+		logger.Fatalw("TRASH_RETENTION_DAYS must be at least 1", "value", cfg.TrashRetention.String())
+	case cfg.AccountDeletionMode != "anonymize" && cfg.AccountDeletionMode != "cascade":
+		logger.Fatalw("ACCOUNT_DELETION_MODE must be one of: anonymize cascade", "value", cfg.AccountDeletionMode)
+	case cfg.PasswordHasher != "argon2id" && cfg.PasswordHasher != "bcrypt":
+		logger.Fatalw("PASSWORD_HASHER must be one of: argon2id bcrypt", "value", cfg.PasswordHasher)
+	case cfg.Argon2Memory < 8*cfg.Argon2Parallelism || cfg.Argon2Memory > 4*1024*1024:
+		logger.Fatalw("ARGON2_MEMORY_KIB must be at least 8 times ARGON2_PARALLELISM and at most 4194304",
+			"value", cfg.Argon2Memory)
+	case cfg.Argon2Iterations < 1:
+		logger.Fatalw("ARGON2_ITERATIONS must be at least 1", "value", cfg.Argon2Iterations)
+	case cfg.Argon2Parallelism < 1 || cfg.Argon2Parallelism > 255:
+		logger.Fatalw("ARGON2_PARALLELISM must be between 1 and 255", "value", cfg.Argon2Parallelism)
+	case cfg.BcryptCost < 10 || cfg.BcryptCost > 31:
+		logger.Fatalw("BCRYPT_COST must be between 10 and 31", "value", cfg.BcryptCost)
+	}
+	return cfg
+}
+
+// getOIDCProviders reads OIDC_PROVIDERS, a comma separated list of names, and
+// for every name the OIDC_<NAME>_ISSUER, _CLIENT_ID and _CLIENT_SECRET variables.
+func getOIDCProviders(logger *zap.SugaredLogger) []OIDCProvider {
+	var providers []OIDCProvider
+	for _, name := range strings.Split(getEnv(logger, "OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if strings.Trim(name, "abcdefghijklmnopqrstuvwxyz0123456789") != "" {
+			logger.Fatalw("OIDC provider names may only contain letters and digits", "value", name)
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, OIDCProvider{
+			Name:         name,
+			Issuer:       mustGetEnv(logger, prefix+"ISSUER"),
+			ClientID:     mustGetEnv(logger, prefix+"CLIENT_ID"),
+			ClientSecret: mustGetEnv(logger, prefix+"CLIENT_SECRET"),
+		})
+	}
+	return providers
 }
 
 func getEnv(logger *zap.SugaredLogger, key, defaultVal string) string {
@@ -55,3 +217,61 @@ func mustGetEnv(logger *zap.SugaredLogger, key string) string {
 	}
 	return val
 }
+
+// getDurationEnv - Parses values like "15m" or "720h" (see time.ParseDuration)
+func getDurationEnv(logger *zap.SugaredLogger, key string, defaultVal time.Duration) time.Duration {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		logger.Infow("using default value for env variable",
+			"key", key,
+			"default", defaultVal.String(),
+		)
+		return defaultVal
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		logger.Fatalw("invalid duration in env variable",
+			"key", key,
+			"value", val,
+		)
+	}
+	return d
+}
+
+func getIntEnv(logger *zap.SugaredLogger, key string, defaultVal int) int {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		logger.Infow("using default value for env variable",
+			"key", key,
+			"default", defaultVal,
+		)
+		return defaultVal
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 0 {
+		logger.Fatalw("invalid integer in env variable",
+			"key", key,
+			"value", val,
+		)
+	}
+	return n
+}
+
+func getBoolEnv(logger *zap.SugaredLogger, key string, defaultVal bool) bool {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		logger.Infow("using default value for env variable",
+			"key", key,
+			"default", defaultVal,
+		)
+		return defaultVal
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		logger.Fatalw("invalid boolean in env variable",
+			"key", key,
+			"value", val,
+		)
+	}
+	return b
+}
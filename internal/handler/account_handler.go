@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"maxwellzp/blog-api/internal/middleware"
+	"maxwellzp/blog-api/internal/model"
+	"maxwellzp/blog-api/internal/service"
+	"maxwellzp/blog-api/internal/validation"
+	"net/http"
+	"time"
+)
+
+type AccountHandler struct {
+	AccountService service.AccountService
+	Logger         *zap.SugaredLogger
+	Validator      *validation.Validator
+}
+
+func NewAccountHandler(
+	accountService service.AccountService,
+	logger *zap.SugaredLogger,
+	validator *validation.Validator,
+) *AccountHandler {
+	return &AccountHandler{AccountService: accountService, Logger: logger, Validator: validator}
+}
+
+// Accounts created through an external provider have no password to confirm with
+type deleteAccountRequest struct {
+	Password string `json:"password" validate:"max=256"`
+}
+
+// Export downloads everything stored about the current user, as a ZIP
+// archive of JSON files by default or as a single JSON document with
+// ?format=json
+func (h *AccountHandler) Export(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	format := c.QueryParam("format")
+	if format != "" && format != "zip" && format != "json" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "format must be zip or json"})
+	}
+
+	export, err := h.AccountService.Export(c.Request().Context(), userID)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+		h.Logger.Errorw("Error exporting account",
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	h.Logger.Infow("Security event",
+		"event", "account_exported",
+		"user_id", userID,
+		"format", format,
+		"ip", c.RealIP(),
+		"status", http.StatusOK,
+	)
+
+	name := fmt.Sprintf("account-%d-%s", userID, export.ExportedAt.Format("20060102"))
+	if format == "json" {
+		c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+name+`.json"`)
+		return c.JSON(http.StatusOK, export)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "application/zip")
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+name+`.zip"`)
+	c.Response().WriteHeader(http.StatusOK)
+	if err := writeExportZip(c.Response(), export); err != nil {
+		// Too late for an error response, the client gets a truncated archive
+		h.Logger.Errorw("Error writing account export",
+			"error", err,
+			"user_id", userID,
+		)
+	}
+	return nil
+}
+
+func writeExportZip(w http.ResponseWriter, export *model.AccountExport) error {
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", export.Profile},
+		{"blogs.json", export.Blogs},
+		{"comments.json", export.Comments},
+	}
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     f.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// Delete schedules the current account for deletion. It is carried out
+// after the grace period unless the user logs in again before then.
+func (h *AccountHandler) Delete(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	var req deleteAccountRequest
+	if err := c.Bind(&req); err != nil {
+		h.Logger.Errorw("Error binding delete account request",
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusBadRequest,
+		)
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	if fieldErrors := h.Validator.ValidateStruct(&req); fieldErrors != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": fieldErrors,
+		})
+	}
+
+	purgeAt, err := h.AccountService.RequestDeletion(c.Request().Context(), userID, req.Password)
+	if err != nil {
+		if errors.Is(err, service.ErrWrongPassword) {
+			h.Logger.Warnw("Wrong password on account deletion",
+				"user_id", userID,
+				"status", http.StatusForbidden,
+			)
+			return c.JSON(http.StatusForbidden, echo.Map{"error": "password is incorrect"})
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+		h.Logger.Errorw("Error deleting account",
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	h.Logger.Warnw("Security event",
+		"event", "account_deletion_requested",
+		"user_id", userID,
+		"purge_at", purgeAt,
+		"ip", c.RealIP(),
+		"status", http.StatusAccepted,
+	)
+	return c.JSON(http.StatusAccepted, echo.Map{
+		"purge_at": purgeAt.UTC().Format(time.RFC3339),
+		"message":  "account will be deleted at purge_at; log in before then to cancel",
+	})
+}
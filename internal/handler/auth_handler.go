@@ -1,36 +1,57 @@
 package handler
 
 import (
+	"errors"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
+	"math"
+	"maxwellzp/blog-api/internal/middleware"
 	"maxwellzp/blog-api/internal/service"
 	"maxwellzp/blog-api/internal/validation"
 	"net/http"
+	"strconv"
 )
 
 type AuthHandler struct {
-	AuthService service.AuthService
-	Logger      *zap.SugaredLogger
-	Validator   *validation.Validator
+	AuthService         service.AuthService
+	VerificationService service.VerificationService
+	Logger              *zap.SugaredLogger
+	Validator           *validation.Validator
 }
 
 func NewAuthHandler(
 	authService service.AuthService,
+	verificationService service.VerificationService,
 	logger *zap.SugaredLogger,
 	validator *validation.Validator,
 ) *AuthHandler {
-	return &AuthHandler{AuthService: authService, Logger: logger, Validator: validator}
+	return &AuthHandler{
+		AuthService:         authService,
+		VerificationService: verificationService,
+		Logger:              logger,
+		Validator:           validator,
+	}
 }
 
 type registerRequest struct {
 	Username string `json:"username" validate:"required,min=5,max=30,alphanumunicode"`
 	Email    string `json:"email" validate:"required,email,max=255"`
-	Password string `json:"password" validate:"required,min=12,max=40,containsuppercase,containslowercase,containsnumber,containsspecial"`
+	Password string `json:"password" validate:"required,min=12,max=256,containsuppercase,containslowercase,containsnumber,containsspecial"`
 }
 
 type loginRequest struct {
 	Email    string `json:"email" validate:"required,email,max=255"`
-	Password string `json:"password" validate:"required,min=8,max=40"`
+	Password string `json:"password" validate:"required,min=8,max=256"`
+}
+
+type mfaLoginRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	// A 6 digit authenticator code or a recovery code
+	Code string `json:"code" validate:"required,min=6,max=20"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
 func (h *AuthHandler) Register(c echo.Context) error {
@@ -56,6 +77,12 @@ func (h *AuthHandler) Register(c echo.Context) error {
 
 	user, err := h.AuthService.Register(ctx, req.Username, req.Email, req.Password)
 	if err != nil {
+		if errors.Is(err, service.ErrPasswordTooLong) {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"error":  "validation failed",
+				"fields": map[string]string{"password": err.Error()},
+			})
+		}
 		h.Logger.Errorw("Error registering user",
 			"error", err,
 			"email", req.Email,
@@ -65,6 +92,14 @@ func (h *AuthHandler) Register(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid registration request"})
 	}
 
+	// The account exists either way; a lost email can be sent again from /me/verify-email
+	if err := h.VerificationService.SendVerification(ctx, user); err != nil {
+		h.Logger.Errorw("Error sending verification email",
+			"error", err,
+			"user_id", user.ID,
+		)
+	}
+
 	h.Logger.Infow("Successfully registered user",
 		"user", user,
 		"status", http.StatusCreated,
@@ -72,6 +107,63 @@ func (h *AuthHandler) Register(c echo.Context) error {
 	return c.JSON(http.StatusCreated, user)
 }
 
+func (h *AuthHandler) VerifyEmail(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": map[string]string{"token": "token is required"},
+		})
+	}
+
+	if err := h.VerificationService.Verify(c.Request().Context(), token); err != nil {
+		if errors.Is(err, service.ErrInvalidVerificationToken) {
+			h.Logger.Warnw("Rejected email verification token",
+				"status", http.StatusBadRequest,
+			)
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid or expired verification token"})
+		}
+		h.Logger.Errorw("Error verifying email",
+			"error", err,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	h.Logger.Infow("Email verified",
+		"status", http.StatusOK,
+	)
+	return c.JSON(http.StatusOK, echo.Map{"message": "email verified"})
+}
+
+func (h *AuthHandler) ResendVerification(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	if err := h.VerificationService.Resend(c.Request().Context(), userID); err != nil {
+		if errors.Is(err, service.ErrEmailAlreadyVerified) {
+			return c.JSON(http.StatusConflict, echo.Map{"error": "email is already verified"})
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+		h.Logger.Errorw("Error resending verification email",
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	h.Logger.Infow("Verification email resent",
+		"user_id", userID,
+		"status", http.StatusAccepted,
+	)
+	return c.NoContent(http.StatusAccepted)
+}
+
 func (h *AuthHandler) Login(c echo.Context) error {
 	ctx := c.Request().Context()
 
@@ -93,7 +185,11 @@ func (h *AuthHandler) Login(c echo.Context) error {
 		})
 	}
 
-	user, token, err := h.AuthService.Login(ctx, req.Email, req.Password)
+	result, err := h.AuthService.Login(ctx, req.Email, req.Password, clientInfo(c))
+	var locked *service.AccountLockedError
+	if errors.As(err, &locked) {
+		return h.accountLocked(c, req.Email, locked)
+	}
 	if err != nil {
 		h.Logger.Errorw("Error logging user",
 			"error", err,
@@ -103,12 +199,179 @@ func (h *AuthHandler) Login(c echo.Context) error {
 		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "something went wrong"})
 	}
 
+	if result.MFAToken != "" {
+		h.Logger.Infow("Login needs a second factor",
+			"user_id", result.User.ID,
+			"status", http.StatusOK,
+		)
+		return c.JSON(http.StatusOK, loginResponse(result))
+	}
+
 	h.Logger.Infow("User logged in",
-		"user", user,
+		"user", result.User,
+		"status", http.StatusOK,
+	)
+	return c.JSON(http.StatusOK, loginResponse(result))
+}
+
+// LoginMFA completes a login started with Login for an account with 2FA
+func (h *AuthHandler) LoginMFA(c echo.Context) error {
+	var req mfaLoginRequest
+	if err := c.Bind(&req); err != nil {
+		h.Logger.Errorw("Error binding mfa login request",
+			"error", err,
+			"status", http.StatusBadRequest,
+		)
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	if fieldErrors := h.Validator.ValidateStruct(&req); fieldErrors != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": fieldErrors,
+		})
+	}
+
+	result, err := h.AuthService.CompleteMFA(c.Request().Context(), req.MFAToken, req.Code, clientInfo(c))
+	var locked *service.AccountLockedError
+	if errors.As(err, &locked) {
+		return h.accountLocked(c, "", locked)
+	}
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidMFAToken) || errors.Is(err, service.ErrInvalidCredentials) {
+			h.Logger.Warnw("Rejected second factor",
+				"error", err,
+				"ip", c.RealIP(),
+				"status", http.StatusUnauthorized,
+			)
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid code or mfa token"})
+		}
+		h.Logger.Errorw("Error completing mfa login",
+			"error", err,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	h.Logger.Infow("User logged in with second factor",
+		"user", result.User,
 		"status", http.StatusOK,
 	)
-	return c.JSON(http.StatusOK, echo.Map{
-		"user":  user,
-		"token": token,
+	return c.JSON(http.StatusOK, loginResponse(result))
+}
+
+// loginResponse answers with tokens, or with an MFA challenge for accounts
+// with 2FA
+func loginResponse(result *service.LoginResult) echo.Map {
+	if result.MFAToken != "" {
+		return echo.Map{
+			"mfa_required": true,
+			"mfa_token":    result.MFAToken,
+			"expires_in":   result.MFAExpiresIn,
+		}
+	}
+	return echo.Map{
+		"user":          result.User,
+		"token":         result.Tokens.AccessToken,
+		"refresh_token": result.Tokens.RefreshToken,
+		"expires_in":    result.Tokens.ExpiresIn,
+	}
+}
+
+// clientInfo describes the device a login comes from, for the session list
+func clientInfo(c echo.Context) service.ClientInfo {
+	return service.ClientInfo{UserAgent: c.Request().UserAgent(), IP: c.RealIP()}
+}
+
+// accountLocked answers 429 with the remaining lockout time, both in the
+// Retry-After header and in the body.
+func (h *AuthHandler) accountLocked(c echo.Context, email string, locked *service.AccountLockedError) error {
+	retryAfter := int64(math.Ceil(locked.RetryAfter.Seconds()))
+	event := "login_while_locked"
+	if locked.Started {
+		event = "account_locked"
+	}
+	h.Logger.Warnw("Security event",
+		"event", event,
+		"email", email,
+		"ip", c.RealIP(),
+		"retry_after", retryAfter,
+		"status", http.StatusTooManyRequests,
+	)
+
+	c.Response().Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	return c.JSON(http.StatusTooManyRequests, echo.Map{
+		"error":       "too many failed login attempts",
+		"retry_after": retryAfter,
 	})
 }
+
+func (h *AuthHandler) Refresh(c echo.Context) error {
+	var req refreshRequest
+	if err := c.Bind(&req); err != nil {
+		h.Logger.Errorw("Error binding refresh request",
+			"error", err,
+			"status", http.StatusBadRequest,
+		)
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	if fieldErrors := h.Validator.ValidateStruct(&req); fieldErrors != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": fieldErrors,
+		})
+	}
+
+	tokens, err := h.AuthService.Refresh(c.Request().Context(), req.RefreshToken, clientInfo(c))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			h.Logger.Warnw("Rejected refresh token",
+				"error", err,
+				"status", http.StatusUnauthorized,
+			)
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid refresh token"})
+		}
+		h.Logger.Errorw("Error refreshing token",
+			"error", err,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+func (h *AuthHandler) Logout(c echo.Context) error {
+	var req refreshRequest
+	if err := c.Bind(&req); err != nil {
+		h.Logger.Errorw("Error binding logout request",
+			"error", err,
+			"status", http.StatusBadRequest,
+		)
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	if fieldErrors := h.Validator.ValidateStruct(&req); fieldErrors != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": fieldErrors,
+		})
+	}
+
+	if err := h.AuthService.Logout(c.Request().Context(), req.RefreshToken); err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid refresh token"})
+		}
+		h.Logger.Errorw("Error logging out",
+			"error", err,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	h.Logger.Infow("User logged out",
+		"status", http.StatusNoContent,
+	)
+	return c.NoContent(http.StatusNoContent)
+}
@@ -1,15 +1,19 @@
 package handler
 
 import (
+	"context"
 	"errors"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 	"maxwellzp/blog-api/internal/helpers"
 	"maxwellzp/blog-api/internal/middleware"
+	"maxwellzp/blog-api/internal/model"
 	"maxwellzp/blog-api/internal/service"
 	"maxwellzp/blog-api/internal/validation"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type BlogHandler struct {
@@ -26,9 +30,27 @@ func NewBlogHandler(
 	return &BlogHandler{BlogService: blogService, Logger: logger, Validator: validator}
 }
 
+// Content is capped so that it fits the TEXT column even in four-byte
+// characters, and so that revision diffs stay cheap
 type blogRequest struct {
-	Title   string `json:"title" validate:"required,min=3,max=100"`
-	Content string `json:"content" validate:"required,min=10"`
+	Title     string     `json:"title" validate:"required,min=3,max=100"`
+	Content   string     `json:"content" validate:"required,min=10,max=16000"`
+	PublishAt *time.Time `json:"publish_at"`
+	Tags      []string   `json:"tags" validate:"omitempty,max=10,dive,min=1,max=50"`
+}
+
+func (r blogRequest) toInput() service.BlogInput {
+	return service.BlogInput{
+		Title:     r.Title,
+		Content:   r.Content,
+		PublishAt: r.PublishAt,
+		Tags:      r.Tags,
+	}
+}
+
+type createBlogRequest struct {
+	blogRequest
+	Status string `json:"status" validate:"omitempty,oneof=draft published"`
 }
 
 func (h *BlogHandler) Create(c echo.Context) error {
@@ -36,7 +58,7 @@ func (h *BlogHandler) Create(c echo.Context) error {
 	if err != nil {
 		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
 	}
-	var req blogRequest
+	var req createBlogRequest
 	if err := c.Bind(&req); err != nil {
 		h.Logger.Errorw("Error binding blog create request",
 			"error", err,
@@ -57,8 +79,16 @@ func (h *BlogHandler) Create(c echo.Context) error {
 
 	// c.Request().Context() extracts the context.Context from the incoming HTTP request.
 	// This context includes: Timeout/cancel signals from the client.
-	blog, err := h.BlogService.Create(c.Request().Context(), userID, req.Title, req.Content)
+	input := req.toInput()
+	input.Status = model.BlogStatus(req.Status)
+	blog, err := h.BlogService.Create(c.Request().Context(), userID, input)
 	if err != nil {
+		if errors.Is(err, service.ErrPublishAtInPast) {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"error":  "validation failed",
+				"fields": map[string]string{"publish_at": err.Error()},
+			})
+		}
 		h.Logger.Errorw("Error creating blog",
 			"error", err,
 			"user_id", userID,
@@ -73,6 +103,7 @@ func (h *BlogHandler) Create(c echo.Context) error {
 		"blog_id", blog.ID,
 		"status", http.StatusCreated,
 	)
+	c.Response().Header().Set("ETag", etag(blog.Version))
 	return c.JSON(http.StatusCreated, blog)
 }
 
@@ -88,7 +119,17 @@ func (h *BlogHandler) GetByID(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid id"})
 	}
 
-	blog, err := h.BlogService.GetByID(c.Request().Context(), id)
+	expand, err := helpers.GetExpand(c, "author")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": map[string]string{"expand": err.Error()},
+		})
+	}
+
+	// Anonymous readers get viewer id 0 and only see published blogs
+	viewerID, _ := middleware.GetUserID(c)
+	blog, err := h.BlogService.GetByID(c.Request().Context(), id, viewerID)
 	if err != nil {
 		h.Logger.Errorw("Failed to get blog by id",
 			"blog_id", id,
@@ -97,6 +138,28 @@ func (h *BlogHandler) GetByID(c echo.Context) error {
 		)
 		return c.JSON(http.StatusNotFound, echo.Map{"error": "blog not found"})
 	}
+	if err := h.expandBlogs(c.Request().Context(), []*model.Blog{blog}, expand); err != nil {
+		h.Logger.Errorw("Error expanding blog",
+			"blog_id", id,
+			"error", err,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "error getting blog"})
+	}
+
+	tag, err := expandedETag(blog.Version, expand, blog.Author)
+	if err != nil {
+		h.Logger.Errorw("Error computing blog ETag",
+			"blog_id", id,
+			"error", err,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "error getting blog"})
+	}
+	c.Response().Header().Set("ETag", tag)
+	if notModified(c, tag) {
+		return c.NoContent(http.StatusNotModified)
+	}
 
 	h.Logger.Infow("Blog found successfully",
 		"blog_id", blog.ID,
@@ -122,16 +185,13 @@ func (h *BlogHandler) Update(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid id"})
 	}
 
-	isOwner, err := h.BlogService.IsOwner(c.Request().Context(), id, userID)
-	if err != nil {
-		if errors.Is(err, service.ErrBlogNotFound) {
-			return c.JSON(http.StatusNotFound, echo.Map{"error": "blog not found"})
-		}
-		h.Logger.Errorw("Error checking blog ownership", "blog_id", id, "user_id", userID, "error", err)
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	if ok, err := h.checkBlogAccess(c, id, userID, "modify"); !ok {
+		return err
 	}
-	if !isOwner {
-		return c.JSON(http.StatusForbidden, echo.Map{"error": "you are not allowed to modify this blog"})
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return preconditionFailed(c, err)
 	}
 
 	var req blogRequest
@@ -154,8 +214,20 @@ func (h *BlogHandler) Update(c echo.Context) error {
 		})
 	}
 
-	err = h.BlogService.Update(c.Request().Context(), id, req.Title, req.Content)
+	newVersion, err := h.BlogService.Update(c.Request().Context(), id, userID, version, req.toInput())
 	if err != nil {
+		if errors.Is(err, service.ErrVersionConflict) {
+			return preconditionFailed(c, errIfMatchInvalid)
+		}
+		if errors.Is(err, service.ErrPublishAtInPast) {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"error":  "validation failed",
+				"fields": map[string]string{"publish_at": err.Error()},
+			})
+		}
+		if errors.Is(err, service.ErrBlogAlreadyPublished) {
+			return c.JSON(http.StatusConflict, echo.Map{"error": "blog is already published"})
+		}
 		h.Logger.Errorw("Error updating blog",
 			"blog_id", id,
 			"error", err,
@@ -171,6 +243,7 @@ func (h *BlogHandler) Update(c echo.Context) error {
 		"blog_id", id,
 		"status", http.StatusOK,
 	)
+	c.Response().Header().Set("ETag", etag(newVersion))
 	return c.NoContent(http.StatusOK)
 }
 
@@ -191,19 +264,19 @@ func (h *BlogHandler) Delete(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid id"})
 	}
 
-	isOwner, err := h.BlogService.IsOwner(c.Request().Context(), id, userID)
-	if err != nil {
-		if errors.Is(err, service.ErrBlogNotFound) {
-			return c.JSON(http.StatusNotFound, echo.Map{"error": "blog not found"})
-		}
-		h.Logger.Errorw("Error checking blog ownership", "blog_id", id, "user_id", userID, "error", err)
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	if ok, err := h.checkBlogAccess(c, id, userID, "delete"); !ok {
+		return err
 	}
-	if !isOwner {
-		return c.JSON(http.StatusForbidden, echo.Map{"error": "you are not allowed to delete this blog"})
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return preconditionFailed(c, err)
 	}
 
-	if err := h.BlogService.Delete(c.Request().Context(), id); err != nil {
+	if err := h.BlogService.Delete(c.Request().Context(), id, version); err != nil {
+		if errors.Is(err, service.ErrVersionConflict) {
+			return preconditionFailed(c, errIfMatchInvalid)
+		}
 		h.Logger.Errorw("Error deleting blog",
 			"blog_id", id,
 			"error", err,
@@ -221,8 +294,31 @@ func (h *BlogHandler) Delete(c echo.Context) error {
 }
 
 func (h *BlogHandler) List(c echo.Context) error {
+	filter, fieldErrors := parseBlogFilter(c)
+	if helpers.IsCursorRequest(c) && filter.Sort != "" {
+		fieldErrors["sort"] = "sort is not supported with cursor pagination"
+	}
+	expand, err := helpers.GetExpand(c, "author")
+	if err != nil {
+		fieldErrors["expand"] = err.Error()
+	}
+	if len(fieldErrors) > 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": fieldErrors,
+		})
+	}
+	filter.ViewerID, _ = middleware.GetUserID(c)
+
+	if helpers.IsCursorRequest(c) {
+		return h.listByCursor(c, filter, expand)
+	}
+
 	pagination := helpers.GetPagination(c)
-	blogs, err := h.BlogService.List(c.Request().Context(), pagination.Limit, pagination.Offset)
+	blogs, total, err := h.BlogService.List(c.Request().Context(), filter, pagination.Limit, pagination.Offset)
+	if err == nil {
+		err = h.expandBlogs(c.Request().Context(), blogs, expand)
+	}
 	if err != nil {
 		h.Logger.Errorw("Error listing blogs",
 			"error", err,
@@ -235,5 +331,456 @@ func (h *BlogHandler) List(c echo.Context) error {
 		"blog_count", len(blogs),
 		"status", http.StatusOK,
 	)
+	helpers.SetLinkHeader(c, pagination, total)
+	return c.JSON(http.StatusOK, helpers.NewPage(blogs, pagination, total))
+}
+
+func (h *BlogHandler) listByCursor(c echo.Context, filter model.BlogFilter, expand map[string]bool) error {
+	ks, err := helpers.GetKeyset(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": map[string]string{"cursor": err.Error()},
+		})
+	}
+
+	page, err := h.BlogService.ListByCursor(c.Request().Context(), filter, ks)
+	if err == nil {
+		err = h.expandBlogs(c.Request().Context(), page.Items, expand)
+	}
+	if err != nil {
+		h.Logger.Errorw("Error listing blogs by cursor",
+			"error", err,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "error listing blogs"})
+	}
+
+	h.Logger.Infow("Blogs listed successfully",
+		"blog_count", len(page.Items),
+		"status", http.StatusOK,
+	)
+	return c.JSON(http.StatusOK, page)
+}
+
+// expandBlogs loads the related resources requested with ?expand=
+func (h *BlogHandler) expandBlogs(ctx context.Context, blogs []*model.Blog, expand map[string]bool) error {
+	if expand["author"] {
+		return h.BlogService.ExpandAuthors(ctx, blogs)
+	}
+	return nil
+}
+
+// blogListParams are the query parameters GET /blogs understands, anything
+// else is rejected so that typos do not silently return unfiltered results.
+var blogListParams = map[string]bool{
+	"page": true, "limit": true, "cursor": true, "sort": true, "tag": true,
+	"author_id": true, "title_prefix": true, "created_after": true, "created_before": true,
+	"expand": true,
+}
+
+// parseBlogFilter reads the sort and filter query parameters and returns
+// field errors in the validation failed format.
+func parseBlogFilter(c echo.Context) (model.BlogFilter, map[string]string) {
+	fieldErrors := map[string]string{}
+	for key := range c.QueryParams() {
+		if !blogListParams[key] {
+			fieldErrors[key] = "unknown query parameter"
+		}
+	}
+
+	filter := model.BlogFilter{
+		Tag:         c.QueryParam("tag"),
+		TitlePrefix: c.QueryParam("title_prefix"),
+		Sort:        model.BlogSort(c.QueryParam("sort")),
+	}
+	if !filter.Sort.Valid() {
+		fieldErrors["sort"] = "sort must be one of: " + strings.Join(model.BlogSortFields(), " ") +
+			" (prefix with - for descending order)"
+	}
+	if raw := c.QueryParam("author_id"); raw != "" {
+		authorID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || authorID < 1 {
+			fieldErrors["author_id"] = "author_id must be a positive integer"
+		}
+		filter.AuthorID = authorID
+	}
+	for key, dst := range map[string]**time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+	} {
+		raw := c.QueryParam(key)
+		if raw == "" {
+			continue
+		}
+		t, err := parseQueryTime(raw)
+		if err != nil {
+			fieldErrors[key] = key + " must be an RFC 3339 timestamp or a YYYY-MM-DD date"
+			continue
+		}
+		*dst = &t
+	}
+	return filter, fieldErrors
+}
+
+// parseQueryTime accepts a full RFC 3339 timestamp or a plain date (UTC midnight)
+func parseQueryTime(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, raw)
+}
+
+func (h *BlogHandler) Publish(c echo.Context) error {
+	return h.changeStatus(c, model.BlogStatusPublished)
+}
+
+func (h *BlogHandler) Unpublish(c echo.Context) error {
+	return h.changeStatus(c, model.BlogStatusDraft)
+}
+
+func (h *BlogHandler) Archive(c echo.Context) error {
+	return h.changeStatus(c, model.BlogStatusArchived)
+}
+
+func (h *BlogHandler) changeStatus(c echo.Context, status model.BlogStatus) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	rawID := c.Param("id")
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		h.Logger.Errorw("Error parsing id param in changeStatus",
+			"blog_id", rawID,
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusBadRequest,
+		)
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid id"})
+	}
+
+	if ok, err := h.checkBlogAccess(c, id, userID, "modify"); !ok {
+		return err
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return preconditionFailed(c, err)
+	}
+
+	newVersion, err := h.BlogService.SetStatus(c.Request().Context(), id, version, status)
+	if err != nil {
+		if errors.Is(err, service.ErrVersionConflict) {
+			return preconditionFailed(c, errIfMatchInvalid)
+		}
+		h.Logger.Errorw("Error changing blog status",
+			"blog_id", id,
+			"blog_status", status,
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "error changing blog status"})
+	}
+
+	h.Logger.Infow("Blog status changed",
+		"blog_id", id,
+		"blog_status", status,
+		"status", http.StatusOK,
+	)
+	c.Response().Header().Set("ETag", etag(newVersion))
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *BlogHandler) ListTags(c echo.Context) error {
+	tags, err := h.BlogService.ListTags(c.Request().Context())
+	if err != nil {
+		h.Logger.Errorw("Error listing tags",
+			"error", err,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "error listing tags"})
+	}
+
+	h.Logger.Infow("Tags listed successfully",
+		"tag_count", len(tags),
+		"status", http.StatusOK,
+	)
+	return c.JSON(http.StatusOK, tags)
+}
+
+// checkBlogAccess writes the error response itself and reports whether the
+// current user may manage the blog; action completes the 403 message.
+func (h *BlogHandler) checkBlogAccess(c echo.Context, id, userID int64, action string) (bool, error) {
+	isOwner, err := h.BlogService.IsOwner(c.Request().Context(), id, userID)
+	if err != nil {
+		if errors.Is(err, service.ErrBlogNotFound) {
+			return false, c.JSON(http.StatusNotFound, echo.Map{"error": "blog not found"})
+		}
+		h.Logger.Errorw("Error checking blog ownership", "blog_id", id, "user_id", userID, "error", err)
+		return false, c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+	if !isOwner && !middleware.GetRole(c).CanManageBlogs() {
+		return false, c.JSON(http.StatusForbidden, echo.Map{"error": "you are not allowed to " + action + " this blog"})
+	}
+	return true, nil
+}
+
+func (h *BlogHandler) ListRevisions(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid id"})
+	}
+	if ok, err := h.checkBlogAccess(c, id, userID, "access"); !ok {
+		return err
+	}
+
+	revisions, err := h.BlogService.ListRevisions(c.Request().Context(), id)
+	if err != nil {
+		h.Logger.Errorw("Error listing blog revisions",
+			"blog_id", id,
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "error listing revisions"})
+	}
+
+	h.Logger.Infow("Blog revisions listed successfully",
+		"blog_id", id,
+		"revision_count", len(revisions),
+		"status", http.StatusOK,
+	)
+	return c.JSON(http.StatusOK, revisions)
+}
+
+func (h *BlogHandler) GetRevision(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid id"})
+	}
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid revision"})
+	}
+	if ok, err := h.checkBlogAccess(c, id, userID, "access"); !ok {
+		return err
+	}
+
+	revision, err := h.BlogService.GetRevision(c.Request().Context(), id, rev)
+	if err != nil {
+		if errors.Is(err, service.ErrRevisionNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "revision not found"})
+		}
+		h.Logger.Errorw("Error getting blog revision",
+			"blog_id", id,
+			"revision", rev,
+			"error", err,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "error getting revision"})
+	}
+
+	return c.JSON(http.StatusOK, revision)
+}
+
+func (h *BlogHandler) DiffRevisions(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid id"})
+	}
+
+	fieldErrors := map[string]string{}
+	from, err := strconv.Atoi(c.QueryParam("from"))
+	if err != nil {
+		fieldErrors["from"] = "from must be a revision number"
+	}
+	to, err := strconv.Atoi(c.QueryParam("to"))
+	if err != nil {
+		fieldErrors["to"] = "to must be a revision number"
+	}
+	if len(fieldErrors) > 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": fieldErrors,
+		})
+	}
+	if ok, err := h.checkBlogAccess(c, id, userID, "access"); !ok {
+		return err
+	}
+
+	diff, err := h.BlogService.DiffRevisions(c.Request().Context(), id, from, to)
+	if err != nil {
+		if errors.Is(err, service.ErrRevisionNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "revision not found"})
+		}
+		if errors.Is(err, helpers.ErrDiffTooLarge) {
+			h.Logger.Warnw("Blog revisions too different to diff",
+				"blog_id", id,
+				"from", from,
+				"to", to,
+				"status", http.StatusUnprocessableEntity,
+			)
+			return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": "too many changed lines to diff these revisions"})
+		}
+		h.Logger.Errorw("Error diffing blog revisions",
+			"blog_id", id,
+			"from", from,
+			"to", to,
+			"error", err,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "error diffing revisions"})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"from": from,
+		"to":   to,
+		"diff": diff,
+	})
+}
+
+func (h *BlogHandler) RestoreRevision(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid id"})
+	}
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid revision"})
+	}
+	if ok, err := h.checkBlogAccess(c, id, userID, "modify"); !ok {
+		return err
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return preconditionFailed(c, err)
+	}
+
+	newVersion, err := h.BlogService.RestoreRevision(c.Request().Context(), id, rev, userID, version)
+	if err != nil {
+		if errors.Is(err, service.ErrVersionConflict) {
+			return preconditionFailed(c, errIfMatchInvalid)
+		}
+		if errors.Is(err, service.ErrRevisionNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "revision not found"})
+		}
+		h.Logger.Errorw("Error restoring blog revision",
+			"blog_id", id,
+			"revision", rev,
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "error restoring revision"})
+	}
+
+	h.Logger.Infow("Blog revision restored",
+		"blog_id", id,
+		"revision", rev,
+		"user_id", userID,
+		"status", http.StatusOK,
+	)
+	c.Response().Header().Set("ETag", etag(newVersion))
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *BlogHandler) ListTrash(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	pagination := helpers.GetPagination(c)
+	blogs, err := h.BlogService.ListTrash(c.Request().Context(), userID, pagination.Limit, pagination.Offset)
+	if err != nil {
+		h.Logger.Errorw("Error listing trash",
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "error listing trash"})
+	}
+
+	h.Logger.Infow("Trash listed successfully",
+		"blog_count", len(blogs),
+		"user_id", userID,
+		"status", http.StatusOK,
+	)
 	return c.JSON(http.StatusOK, blogs)
 }
+
+func (h *BlogHandler) Restore(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	rawID := c.Param("id")
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		h.Logger.Errorw("Error parsing id param in Restore",
+			"blog_id", rawID,
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusBadRequest,
+		)
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid id"})
+	}
+
+	isOwner, err := h.BlogService.IsOwnerOfDeleted(c.Request().Context(), id, userID)
+	if err != nil {
+		if errors.Is(err, service.ErrBlogNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "blog not found in trash"})
+		}
+		h.Logger.Errorw("Error checking blog ownership", "blog_id", id, "user_id", userID, "error", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+	if !isOwner && !middleware.GetRole(c).CanManageBlogs() {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "you are not allowed to restore this blog"})
+	}
+
+	// The version comes from the trash listing
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return preconditionFailed(c, err)
+	}
+
+	newVersion, err := h.BlogService.Restore(c.Request().Context(), id, version)
+	if err != nil {
+		if errors.Is(err, service.ErrVersionConflict) {
+			return preconditionFailed(c, errIfMatchInvalid)
+		}
+		h.Logger.Errorw("Error restoring blog",
+			"blog_id", id,
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "error restoring blog"})
+	}
+
+	h.Logger.Infow("Blog restored successfully",
+		"blog_id", id,
+		"status", http.StatusOK,
+	)
+	c.Response().Header().Set("ETag", etag(newVersion))
+	return c.NoContent(http.StatusOK)
+}
@@ -1,11 +1,13 @@
 package handler
 
 import (
+	"context"
 	"errors"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 	"maxwellzp/blog-api/internal/helpers"
 	"maxwellzp/blog-api/internal/middleware"
+	"maxwellzp/blog-api/internal/model"
 	"maxwellzp/blog-api/internal/service"
 	"maxwellzp/blog-api/internal/validation"
 	"net/http"
@@ -29,6 +31,8 @@ func NewCommentHandler(
 type commentRequest struct {
 	BlogID  int64  `json:"blog_id" validate:"required"`
 	Content string `json:"content" validate:"required,min=3,max=255"`
+	// ParentID is only used on create; replies cannot be moved afterwards
+	ParentID *int64 `json:"parent_id"`
 }
 
 func (h *CommentHandler) Create(c echo.Context) error {
@@ -55,8 +59,11 @@ func (h *CommentHandler) Create(c echo.Context) error {
 		})
 	}
 
-	comment, err := h.CommentService.Create(c.Request().Context(), userID, req.BlogID, req.Content)
+	comment, err := h.CommentService.Create(c.Request().Context(), userID, req.BlogID, req.ParentID, req.Content)
 	if err != nil {
+		if errors.Is(err, service.ErrBlogNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "blog not found"})
+		}
 		h.Logger.Errorw("Error creating comment",
 			"err", err,
 			"user_id", userID,
@@ -71,6 +78,7 @@ func (h *CommentHandler) Create(c echo.Context) error {
 		"comment_id", comment.ID,
 		"status", http.StatusCreated,
 	)
+	c.Response().Header().Set("ETag", etag(comment.Version))
 	return c.JSON(http.StatusCreated, comment)
 }
 
@@ -85,7 +93,17 @@ func (h *CommentHandler) GetByID(c echo.Context) error {
 		)
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid id"})
 	}
-	comment, err := h.CommentService.GetByID(c.Request().Context(), id)
+	expand, err := helpers.GetExpand(c, "author", "blog")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": map[string]string{"expand": err.Error()},
+		})
+	}
+
+	// Comments on drafts are only visible to the blog's author
+	viewerID, _ := middleware.GetUserID(c)
+	comment, err := h.CommentService.GetByID(c.Request().Context(), id, viewerID)
 	if err != nil {
 		h.Logger.Errorw("Failed to get comment by id",
 			"comment_id", id,
@@ -94,6 +112,28 @@ func (h *CommentHandler) GetByID(c echo.Context) error {
 		)
 		return c.JSON(http.StatusNotFound, echo.Map{"error": "comment not found"})
 	}
+	if err := h.expandComments(c.Request().Context(), []*model.Comment{comment}, viewerID, expand); err != nil {
+		h.Logger.Errorw("Error expanding comment",
+			"comment_id", id,
+			"error", err,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	tag, err := expandedETag(comment.Version, expand, comment.Author, comment.Blog)
+	if err != nil {
+		h.Logger.Errorw("Error computing comment ETag",
+			"comment_id", id,
+			"error", err,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "error getting comment"})
+	}
+	c.Response().Header().Set("ETag", tag)
+	if notModified(c, tag) {
+		return c.NoContent(http.StatusNotModified)
+	}
 
 	h.Logger.Infow("Comment found successfully",
 		"comment_id", comment.ID,
@@ -127,10 +167,15 @@ func (h *CommentHandler) Update(c echo.Context) error {
 		h.Logger.Errorw("Error checking comment ownership", "comment_id", id, "user_id", userID, "error", err)
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
 	}
-	if !isOwner {
+	if !isOwner && !middleware.GetRole(c).CanModerateComments() {
 		return c.JSON(http.StatusForbidden, echo.Map{"error": "you are not allowed to modify this comment"})
 	}
 
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return preconditionFailed(c, err)
+	}
+
 	var req commentRequest
 	if err := c.Bind(&req); err != nil {
 		h.Logger.Errorw("Error binding comment update request",
@@ -151,7 +196,11 @@ func (h *CommentHandler) Update(c echo.Context) error {
 		})
 	}
 
-	if err := h.CommentService.Update(c.Request().Context(), id, req.Content); err != nil {
+	newVersion, err := h.CommentService.Update(c.Request().Context(), id, version, req.Content)
+	if err != nil {
+		if errors.Is(err, service.ErrVersionConflict) {
+			return preconditionFailed(c, errIfMatchInvalid)
+		}
 		h.Logger.Errorw("Error updating comment",
 			"comment_id", id,
 			"error", err,
@@ -167,6 +216,7 @@ func (h *CommentHandler) Update(c echo.Context) error {
 		"comment_id", id,
 		"status", http.StatusOK,
 	)
+	c.Response().Header().Set("ETag", etag(newVersion))
 	return c.NoContent(http.StatusOK)
 }
 
@@ -196,11 +246,19 @@ func (h *CommentHandler) Delete(c echo.Context) error {
 		h.Logger.Errorw("Error checking comment ownership", "comment_id", id, "user_id", userID, "error", err)
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
 	}
-	if !isOwner {
+	if !isOwner && !middleware.GetRole(c).CanModerateComments() {
 		return c.JSON(http.StatusForbidden, echo.Map{"error": "you are not allowed to delete this comment"})
 	}
 
-	if err := h.CommentService.Delete(c.Request().Context(), id); err != nil {
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return preconditionFailed(c, err)
+	}
+
+	if err := h.CommentService.Delete(c.Request().Context(), id, version); err != nil {
+		if errors.Is(err, service.ErrVersionConflict) {
+			return preconditionFailed(c, errIfMatchInvalid)
+		}
 		h.Logger.Errorw("Error deleting comment",
 			"comment_id", id,
 			"error", err,
@@ -229,8 +287,45 @@ func (h *CommentHandler) ListByBlogID(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid blog id"})
 	}
 
+	expand, err := helpers.GetExpand(c, "author", "blog")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": map[string]string{"expand": err.Error()},
+		})
+	}
+
+	viewerID, _ := middleware.GetUserID(c)
 	pagination := helpers.GetPagination(c)
-	comments, err := h.CommentService.ListByBlogID(c.Request().Context(), blogID, pagination.Limit, pagination.Offset)
+	var (
+		comments []*model.Comment
+		total    int64
+	)
+	switch mode := c.QueryParam("mode"); mode {
+	case "", "flat":
+		if helpers.IsCursorRequest(c) {
+			return h.listByCursor(c, blogID, viewerID, expand)
+		}
+		comments, total, err = h.CommentService.ListByBlogID(c.Request().Context(), blogID, viewerID, pagination.Limit, pagination.Offset)
+	case "tree":
+		// Missing or invalid depth falls back to the configured maximum
+		depth, convErr := strconv.Atoi(c.QueryParam("depth"))
+		if convErr != nil {
+			depth = -1
+		}
+		comments, total, err = h.CommentService.ListThreadsByBlogID(c.Request().Context(), blogID, viewerID, depth, pagination.Limit, pagination.Offset)
+	default:
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": map[string]string{"mode": "mode must be one of: flat tree"},
+		})
+	}
+	if err == nil {
+		err = h.expandComments(c.Request().Context(), comments, viewerID, expand)
+	}
+	if errors.Is(err, service.ErrBlogNotFound) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "blog not found"})
+	}
 	if err != nil {
 		h.Logger.Errorw("Error listing comments",
 			"blog_id", blogID,
@@ -245,5 +340,53 @@ func (h *CommentHandler) ListByBlogID(c echo.Context) error {
 		"status", http.StatusOK,
 		"blog_id", blogID,
 	)
-	return c.JSON(http.StatusOK, comments)
+	helpers.SetLinkHeader(c, pagination, total)
+	return c.JSON(http.StatusOK, helpers.NewPage(comments, pagination, total))
+}
+
+// listByCursor only supports the flat mode; threads are paged by their roots
+func (h *CommentHandler) listByCursor(c echo.Context, blogID, viewerID int64, expand map[string]bool) error {
+	ks, err := helpers.GetKeyset(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": map[string]string{"cursor": err.Error()},
+		})
+	}
+
+	page, err := h.CommentService.ListByBlogIDCursor(c.Request().Context(), blogID, viewerID, ks)
+	if err == nil {
+		err = h.expandComments(c.Request().Context(), page.Items, viewerID, expand)
+	}
+	if errors.Is(err, service.ErrBlogNotFound) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "blog not found"})
+	}
+	if err != nil {
+		h.Logger.Errorw("Error listing comments by cursor",
+			"blog_id", blogID,
+			"error", err,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	h.Logger.Infow("Comments listed successfully",
+		"comment_count", len(page.Items),
+		"status", http.StatusOK,
+		"blog_id", blogID,
+	)
+	return c.JSON(http.StatusOK, page)
+}
+
+// expandComments loads the related resources requested with ?expand=
+func (h *CommentHandler) expandComments(ctx context.Context, comments []*model.Comment, viewerID int64, expand map[string]bool) error {
+	if expand["author"] {
+		if err := h.CommentService.ExpandAuthors(ctx, comments); err != nil {
+			return err
+		}
+	}
+	if expand["blog"] {
+		return h.CommentService.ExpandBlogs(ctx, comments, viewerID)
+	}
+	return nil
 }
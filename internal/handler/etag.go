@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	errIfMatchMissing = errors.New("If-Match header is required")
+	errIfMatchInvalid = errors.New("If-Match does not match the current version")
+)
+
+// etag renders a resource version as a strong entity tag
+func etag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// expandedETag tells apart the representations ?expand= produces of the same
+// version, e.g. "3;author;9f86d081884c7d65". The embedded resources have no
+// version of their own, so a hash of their JSON stands in for it and a
+// changed author profile or blog title changes the tag. ifMatchVersion
+// accepts these tags as well.
+func expandedETag(version int, expand map[string]bool, embedded ...any) (string, error) {
+	var names []string
+	for name, ok := range expand {
+		if ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return etag(version), nil
+	}
+	sort.Strings(names)
+
+	data, err := json.Marshal(embedded)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf(`"%d;%s;%x"`, version, strings.Join(names, ","), sum[:8]), nil
+}
+
+// ifMatchVersion returns the version a write is conditional on; "*" yields 0,
+// which the repositories treat as "any version".
+func ifMatchVersion(c echo.Context) (int, error) {
+	header := strings.TrimSpace(c.Request().Header.Get("If-Match"))
+	if header == "" {
+		return 0, errIfMatchMissing
+	}
+	if header == "*" {
+		return 0, nil
+	}
+	// Weak tags never satisfy If-Match (RFC 9110, section 13.1.1)
+	raw, _, _ := strings.Cut(strings.Trim(header, `"`), ";")
+	version, err := strconv.Atoi(raw)
+	if err != nil || strings.HasPrefix(header, "W/") || version < 1 {
+		return 0, errIfMatchInvalid
+	}
+	return version, nil
+}
+
+// preconditionFailed maps ifMatchVersion errors to 428 or 412
+func preconditionFailed(c echo.Context, err error) error {
+	if errors.Is(err, errIfMatchMissing) {
+		return c.JSON(http.StatusPreconditionRequired, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusPreconditionFailed, echo.Map{"error": err.Error()})
+}
+
+// notModified reports whether If-None-Match already names the current tag
+func notModified(c echo.Context, tag string) bool {
+	header := c.Request().Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
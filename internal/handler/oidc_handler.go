@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"maxwellzp/blog-api/internal/oidc"
+	"maxwellzp/blog-api/internal/service"
+	"net/http"
+	"time"
+)
+
+// The cookie only travels to the OIDC routes
+const (
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/auth/oidc/"
+)
+
+type OIDCHandler struct {
+	OIDCService service.OIDCService
+	Logger      *zap.SugaredLogger
+	// Whether the state cookie is limited to HTTPS
+	SecureCookie bool
+	StateTTL     time.Duration
+}
+
+func NewOIDCHandler(
+	oidcService service.OIDCService,
+	logger *zap.SugaredLogger,
+	secureCookie bool,
+	stateTTL time.Duration,
+) *OIDCHandler {
+	return &OIDCHandler{OIDCService: oidcService, Logger: logger, SecureCookie: secureCookie, StateTTL: stateTTL}
+}
+
+func (h *OIDCHandler) Providers(c echo.Context) error {
+	return c.JSON(http.StatusOK, echo.Map{"providers": h.OIDCService.Providers()})
+}
+
+// Start redirects the browser to the provider. The state is kept in a
+// cookie, which ties the callback to the browser that started the login.
+func (h *OIDCHandler) Start(c echo.Context) error {
+	provider := c.Param("provider")
+
+	authRequest, err := h.OIDCService.Begin(c.Request().Context(), provider)
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownOIDCProvider) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+		}
+		h.Logger.Errorw("Error starting OIDC login",
+			"error", err,
+			"provider", provider,
+			"status", http.StatusBadGateway,
+		)
+		return c.JSON(http.StatusBadGateway, echo.Map{"error": "login provider is unavailable"})
+	}
+
+	h.setStateCookie(c, authRequest.StateToken, int(h.StateTTL.Seconds()))
+	return c.Redirect(http.StatusFound, authRequest.URL)
+}
+
+// Callback is where the provider sends the browser back to. It answers like
+// POST /login.
+func (h *OIDCHandler) Callback(c echo.Context) error {
+	provider := c.Param("provider")
+
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": service.ErrInvalidOIDCState.Error()})
+	}
+	// The state is single use whatever the outcome
+	h.setStateCookie(c, "", -1)
+
+	// Set when the user declined or the provider failed
+	if providerError := c.QueryParam("error"); providerError != "" {
+		h.Logger.Warnw("OIDC login failed at provider",
+			"provider", provider,
+			"error", providerError,
+			"error_description", c.QueryParam("error_description"),
+			"status", http.StatusUnauthorized,
+		)
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "login was not completed at the provider"})
+	}
+
+	code := c.QueryParam("code")
+	if code == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": map[string]string{"code": "code is required"},
+		})
+	}
+
+	result, err := h.OIDCService.Complete(c.Request().Context(), provider, code, c.QueryParam("state"), cookie.Value, clientInfo(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnknownOIDCProvider):
+			return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrInvalidOIDCState):
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrOIDCEmailNotVerified):
+			return c.JSON(http.StatusForbidden, echo.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrOIDCAccountNotVerified):
+			h.Logger.Warnw("Security event",
+				"event", "oidc_link_refused",
+				"provider", provider,
+				"ip", c.RealIP(),
+				"status", http.StatusConflict,
+			)
+			return c.JSON(http.StatusConflict, echo.Map{
+				"error": err.Error() + "; log in with your password and verify it first",
+			})
+		case errors.Is(err, oidc.ErrInvalidIDToken), errors.Is(err, oidc.ErrTokenRequest):
+			h.Logger.Warnw("Rejected OIDC login",
+				"error", err,
+				"provider", provider,
+				"ip", c.RealIP(),
+				"status", http.StatusUnauthorized,
+			)
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "login with provider failed"})
+		}
+		h.Logger.Errorw("Error completing OIDC login",
+			"error", err,
+			"provider", provider,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	h.Logger.Infow("User logged in with OIDC provider",
+		"user", result.User,
+		"provider", provider,
+		"status", http.StatusOK,
+	)
+	return c.JSON(http.StatusOK, loginResponse(result))
+}
+
+func (h *OIDCHandler) setStateCookie(c echo.Context, value string, maxAge int) {
+	c.SetCookie(&http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     oidcStateCookiePath,
+		MaxAge:   maxAge,
+		Secure:   h.SecureCookie,
+		HttpOnly: true,
+		// Lax, because the callback is a top-level navigation from the provider
+		SameSite: http.SameSiteLaxMode,
+	})
+}
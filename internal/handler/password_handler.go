@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"maxwellzp/blog-api/internal/middleware"
+	"maxwellzp/blog-api/internal/service"
+	"maxwellzp/blog-api/internal/validation"
+	"net/http"
+	"time"
+)
+
+type PasswordHandler struct {
+	PasswordService service.PasswordService
+	Logger          *zap.SugaredLogger
+	Validator       *validation.Validator
+}
+
+func NewPasswordHandler(
+	passwordService service.PasswordService,
+	logger *zap.SugaredLogger,
+	validator *validation.Validator,
+) *PasswordHandler {
+	return &PasswordHandler{PasswordService: passwordService, Logger: logger, Validator: validator}
+}
+
+// New passwords follow the same rules as in registerRequest
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required,max=256"`
+	NewPassword     string `json:"new_password" validate:"required,min=12,max=256,containsuppercase,containslowercase,containsnumber,containsspecial"`
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+type resetPasswordRequest struct {
+	Token       string `json:"token" validate:"required,max=100"`
+	NewPassword string `json:"new_password" validate:"required,min=12,max=256,containsuppercase,containslowercase,containsnumber,containsspecial"`
+}
+
+func (h *PasswordHandler) Change(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	var req changePasswordRequest
+	if err := c.Bind(&req); err != nil {
+		h.Logger.Errorw("Error binding change password request",
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusBadRequest,
+		)
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	if fieldErrors := h.Validator.ValidateStruct(&req); fieldErrors != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": fieldErrors,
+		})
+	}
+
+	err = h.PasswordService.ChangePassword(c.Request().Context(), userID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		if errors.Is(err, service.ErrWrongPassword) {
+			h.Logger.Warnw("Wrong current password on password change",
+				"user_id", userID,
+				"status", http.StatusForbidden,
+			)
+			return c.JSON(http.StatusForbidden, echo.Map{"error": "current password is incorrect"})
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+		if errors.Is(err, service.ErrPasswordTooLong) {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"error":  "validation failed",
+				"fields": map[string]string{"new_password": err.Error()},
+			})
+		}
+		h.Logger.Errorw("Error changing password",
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	h.Logger.Infow("Password changed",
+		"user_id", userID,
+		"status", http.StatusNoContent,
+	)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// How long a password reset email may take once Forgot has answered
+const forgotPasswordTimeout = time.Minute
+
+// Forgot always answers 202 so that callers cannot tell whether an account
+// exists for the email. The lookup and the email happen after the response,
+// so that the response time does not tell either.
+func (h *PasswordHandler) Forgot(c echo.Context) error {
+	var req forgotPasswordRequest
+	if err := c.Bind(&req); err != nil {
+		h.Logger.Errorw("Error binding forgot password request",
+			"error", err,
+			"status", http.StatusBadRequest,
+		)
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	if fieldErrors := h.Validator.ValidateStruct(&req); fieldErrors != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": fieldErrors,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request().Context()), forgotPasswordTimeout)
+	go func() {
+		defer cancel()
+		if err := h.PasswordService.ForgotPassword(ctx, req.Email); err != nil {
+			h.Logger.Errorw("Error sending password reset email",
+				"error", err,
+				"email", req.Email,
+			)
+		}
+	}()
+
+	h.Logger.Infow("Password reset requested",
+		"email", req.Email,
+		"status", http.StatusAccepted,
+	)
+	return c.NoContent(http.StatusAccepted)
+}
+
+func (h *PasswordHandler) Reset(c echo.Context) error {
+	var req resetPasswordRequest
+	if err := c.Bind(&req); err != nil {
+		h.Logger.Errorw("Error binding reset password request",
+			"error", err,
+			"status", http.StatusBadRequest,
+		)
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	if fieldErrors := h.Validator.ValidateStruct(&req); fieldErrors != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": fieldErrors,
+		})
+	}
+
+	if err := h.PasswordService.ResetPassword(c.Request().Context(), req.Token, req.NewPassword); err != nil {
+		if errors.Is(err, service.ErrInvalidResetToken) {
+			h.Logger.Warnw("Rejected password reset token",
+				"status", http.StatusBadRequest,
+			)
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid or expired reset token"})
+		}
+		if errors.Is(err, service.ErrPasswordTooLong) {
+			return c.JSON(http.StatusBadRequest, echo.Map{
+				"error":  "validation failed",
+				"fields": map[string]string{"new_password": err.Error()},
+			})
+		}
+		h.Logger.Errorw("Error resetting password",
+			"error", err,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	h.Logger.Infow("Password reset",
+		"status", http.StatusNoContent,
+	)
+	return c.NoContent(http.StatusNoContent)
+}
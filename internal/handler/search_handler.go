@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"maxwellzp/blog-api/internal/helpers"
+	"maxwellzp/blog-api/internal/service"
+	"maxwellzp/blog-api/internal/validation"
+	"net/http"
+)
+
+type SearchHandler struct {
+	SearchService service.SearchService
+	Logger        *zap.SugaredLogger
+	Validator     *validation.Validator
+}
+
+func NewSearchHandler(
+	searchService service.SearchService,
+	logger *zap.SugaredLogger,
+	validator *validation.Validator,
+) *SearchHandler {
+	return &SearchHandler{SearchService: searchService, Logger: logger, Validator: validator}
+}
+
+type searchRequest struct {
+	Query string `query:"q" json:"q" validate:"required,min=3,max=100"`
+}
+
+func (h *SearchHandler) Search(c echo.Context) error {
+	var req searchRequest
+	if err := c.Bind(&req); err != nil {
+		h.Logger.Errorw("Error binding search request",
+			"error", err,
+			"status", http.StatusBadRequest,
+		)
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	if fieldErrors := h.Validator.ValidateStruct(&req); fieldErrors != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": fieldErrors,
+		})
+	}
+
+	pagination := helpers.GetPagination(c)
+	results, err := h.SearchService.Search(c.Request().Context(), req.Query, pagination.Limit, pagination.Offset)
+	if err != nil {
+		h.Logger.Errorw("Error searching",
+			"query", helpers.TruncateString(req.Query, 100),
+			"error", err,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "error searching"})
+	}
+
+	h.Logger.Infow("Search completed",
+		"query", helpers.TruncateString(req.Query, 100),
+		"result_count", len(results),
+		"status", http.StatusOK,
+	)
+	return c.JSON(http.StatusOK, results)
+}
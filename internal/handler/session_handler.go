@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"maxwellzp/blog-api/internal/middleware"
+	"maxwellzp/blog-api/internal/service"
+	"net/http"
+	"strconv"
+)
+
+type SessionHandler struct {
+	SessionService service.SessionService
+	Logger         *zap.SugaredLogger
+}
+
+func NewSessionHandler(sessionService service.SessionService, logger *zap.SugaredLogger) *SessionHandler {
+	return &SessionHandler{SessionService: sessionService, Logger: logger}
+}
+
+func (h *SessionHandler) List(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	sessions, err := h.SessionService.List(c.Request().Context(), userID, middleware.GetSessionID(c))
+	if err != nil {
+		h.Logger.Errorw("Error listing sessions",
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, sessions)
+}
+
+// Revoke signs out one device, which may be the current one
+func (h *SessionHandler) Revoke(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid id"})
+	}
+
+	if err := h.SessionService.Revoke(c.Request().Context(), userID, id); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+		}
+		h.Logger.Errorw("Error revoking session",
+			"error", err,
+			"user_id", userID,
+			"session_id", id,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	h.Logger.Warnw("Security event",
+		"event", "session_revoked",
+		"user_id", userID,
+		"session_id", id,
+		"ip", c.RealIP(),
+		"status", http.StatusNoContent,
+	)
+	return c.NoContent(http.StatusNoContent)
+}
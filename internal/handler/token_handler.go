@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"maxwellzp/blog-api/internal/middleware"
+	"maxwellzp/blog-api/internal/model"
+	"maxwellzp/blog-api/internal/service"
+	"maxwellzp/blog-api/internal/validation"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type TokenHandler struct {
+	TokenService service.PersonalAccessTokenService
+	Logger       *zap.SugaredLogger
+	Validator    *validation.Validator
+}
+
+func NewTokenHandler(
+	tokenService service.PersonalAccessTokenService,
+	logger *zap.SugaredLogger,
+	validator *validation.Validator,
+) *TokenHandler {
+	return &TokenHandler{TokenService: tokenService, Logger: logger, Validator: validator}
+}
+
+type createTokenRequest struct {
+	Name   string        `json:"name" validate:"required,max=100"`
+	Scopes []model.Scope `json:"scopes" validate:"required,min=1,dive,oneof=read blogs:write comments:write"`
+	// Tokens without an expiry stay valid until revoked
+	ExpiresInDays *int `json:"expires_in_days" validate:"omitnil,min=1,max=365"`
+}
+
+func (h *TokenHandler) List(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	tokens, err := h.TokenService.List(c.Request().Context(), userID)
+	if err != nil {
+		h.Logger.Errorw("Error listing personal access tokens",
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// Create answers with the token itself. Only its hash is stored, so this is
+// the one time it can be shown.
+func (h *TokenHandler) Create(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	var req createTokenRequest
+	if err := c.Bind(&req); err != nil {
+		h.Logger.Errorw("Error binding create token request",
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusBadRequest,
+		)
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	if fieldErrors := h.Validator.ValidateStruct(&req); fieldErrors != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": fieldErrors,
+		})
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays != nil {
+		t := time.Now().AddDate(0, 0, *req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	token, plain, err := h.TokenService.Create(c.Request().Context(), userID, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		h.Logger.Errorw("Error creating personal access token",
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	h.Logger.Infow("Security event",
+		"event", "personal_access_token_created",
+		"user_id", userID,
+		"token_id", token.ID,
+		"scopes", token.Scopes,
+		"status", http.StatusCreated,
+	)
+	return c.JSON(http.StatusCreated, echo.Map{
+		"token":                 plain,
+		"personal_access_token": token,
+	})
+}
+
+func (h *TokenHandler) Revoke(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid id"})
+	}
+
+	if err := h.TokenService.Revoke(c.Request().Context(), userID, id); err != nil {
+		if errors.Is(err, service.ErrPersonalAccessTokenNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+		}
+		h.Logger.Errorw("Error revoking personal access token",
+			"error", err,
+			"user_id", userID,
+			"token_id", id,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	h.Logger.Warnw("Security event",
+		"event", "personal_access_token_revoked",
+		"user_id", userID,
+		"token_id", id,
+		"status", http.StatusNoContent,
+	)
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"maxwellzp/blog-api/internal/middleware"
+	"maxwellzp/blog-api/internal/service"
+	"maxwellzp/blog-api/internal/validation"
+	"net/http"
+)
+
+type TwoFactorHandler struct {
+	TwoFactorService service.TwoFactorService
+	Logger           *zap.SugaredLogger
+	Validator        *validation.Validator
+}
+
+func NewTwoFactorHandler(
+	twoFactorService service.TwoFactorService,
+	logger *zap.SugaredLogger,
+	validator *validation.Validator,
+) *TwoFactorHandler {
+	return &TwoFactorHandler{TwoFactorService: twoFactorService, Logger: logger, Validator: validator}
+}
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required,min=6,max=20"`
+}
+
+func (h *TwoFactorHandler) Enroll(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	enrollment, err := h.TwoFactorService.Enroll(c.Request().Context(), userID)
+	if err != nil {
+		return h.twoFactorError(c, userID, "Error enrolling two-factor authentication", err)
+	}
+
+	h.Logger.Infow("Two-factor enrollment started",
+		"user_id", userID,
+		"status", http.StatusOK,
+	)
+	return c.JSON(http.StatusOK, enrollment)
+}
+
+func (h *TwoFactorHandler) Confirm(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	var req twoFactorCodeRequest
+	if err := c.Bind(&req); err != nil {
+		h.Logger.Errorw("Error binding two-factor confirm request",
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusBadRequest,
+		)
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	if fieldErrors := h.Validator.ValidateStruct(&req); fieldErrors != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": fieldErrors,
+		})
+	}
+
+	codes, err := h.TwoFactorService.Confirm(c.Request().Context(), userID, req.Code)
+	if err != nil {
+		return h.twoFactorError(c, userID, "Error confirming two-factor authentication", err)
+	}
+
+	h.Logger.Infow("Security event",
+		"event", "two_factor_enabled",
+		"user_id", userID,
+		"status", http.StatusOK,
+	)
+	return c.JSON(http.StatusOK, echo.Map{"recovery_codes": codes})
+}
+
+func (h *TwoFactorHandler) Disable(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	var req twoFactorCodeRequest
+	if err := c.Bind(&req); err != nil {
+		h.Logger.Errorw("Error binding two-factor disable request",
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusBadRequest,
+		)
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	if fieldErrors := h.Validator.ValidateStruct(&req); fieldErrors != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": fieldErrors,
+		})
+	}
+
+	if err := h.TwoFactorService.Disable(c.Request().Context(), userID, req.Code); err != nil {
+		return h.twoFactorError(c, userID, "Error disabling two-factor authentication", err)
+	}
+
+	h.Logger.Warnw("Security event",
+		"event", "two_factor_disabled",
+		"user_id", userID,
+		"status", http.StatusNoContent,
+	)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// twoFactorError maps the errors shared by all two-factor endpoints
+func (h *TwoFactorHandler) twoFactorError(c echo.Context, userID int64, msg string, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		h.Logger.Warnw("Rejected two-factor code",
+			"user_id", userID,
+			"status", http.StatusBadRequest,
+		)
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrTwoFactorAlreadyEnabled),
+		errors.Is(err, service.ErrTwoFactorNotEnrolled),
+		errors.Is(err, service.ErrTwoFactorNotEnabled):
+		return c.JSON(http.StatusConflict, echo.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrUserNotFound):
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	h.Logger.Errorw(msg,
+		"error", err,
+		"user_id", userID,
+		"status", http.StatusInternalServerError,
+	)
+	return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+}
@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"maxwellzp/blog-api/internal/helpers"
+	"maxwellzp/blog-api/internal/middleware"
+	"maxwellzp/blog-api/internal/model"
+	"maxwellzp/blog-api/internal/service"
+	"maxwellzp/blog-api/internal/validation"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type UserHandler struct {
+	UserService service.UserService
+	BlogService service.BlogService
+	Logger      *zap.SugaredLogger
+	Validator   *validation.Validator
+}
+
+func NewUserHandler(
+	userService service.UserService,
+	blogService service.BlogService,
+	logger *zap.SugaredLogger,
+	validator *validation.Validator,
+) *UserHandler {
+	return &UserHandler{UserService: userService, BlogService: blogService, Logger: logger, Validator: validator}
+}
+
+// profileRequest - Omitted fields are left unchanged, an empty string clears the field
+type profileRequest struct {
+	DisplayName *string `json:"display_name" validate:"omitnil,max=100"`
+	Bio         *string `json:"bio" validate:"omitnil,max=1000"`
+	AvatarURL   *string `json:"avatar_url" validate:"omitnil,max=2048"`
+}
+
+// GetByID returns the public profile of a user together with a page of
+// their published blogs.
+func (h *UserHandler) GetByID(c echo.Context) error {
+	rawID := c.Param("id")
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		h.Logger.Errorw("Error parsing id param in GetByID",
+			"target_user_id", rawID,
+			"error", err,
+			"status", http.StatusBadRequest,
+		)
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid id"})
+	}
+
+	user, err := h.UserService.GetByID(c.Request().Context(), id)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "user not found"})
+		}
+		h.Logger.Errorw("Error getting user",
+			"target_user_id", id,
+			"error", err,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	// ViewerID stays zero so that only published blogs are listed, even to the owner
+	pagination := helpers.GetPagination(c)
+	filter := model.BlogFilter{AuthorID: id}
+	blogs, total, err := h.BlogService.List(c.Request().Context(), filter, pagination.Limit, pagination.Offset)
+	if err != nil {
+		h.Logger.Errorw("Error listing user blogs",
+			"target_user_id", id,
+			"error", err,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	h.Logger.Infow("User profile retrieved",
+		"target_user_id", id,
+		"status", http.StatusOK,
+	)
+	helpers.SetLinkHeader(c, pagination, total)
+	return c.JSON(http.StatusOK, echo.Map{
+		"user":  user.PublicProfile(),
+		"blogs": helpers.NewPage(blogs, pagination, total),
+	})
+}
+
+func (h *UserHandler) Me(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	user, err := h.UserService.GetByID(c.Request().Context(), userID)
+	if err != nil {
+		// The token outlived its account
+		if errors.Is(err, service.ErrUserNotFound) {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+		h.Logger.Errorw("Error getting current user",
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+	return c.JSON(http.StatusOK, user)
+}
+
+func (h *UserHandler) UpdateMe(c echo.Context) error {
+	userID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+
+	var req profileRequest
+	if err := c.Bind(&req); err != nil {
+		h.Logger.Errorw("Error binding profile update request",
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusBadRequest,
+		)
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	fieldErrors := h.Validator.ValidateStruct(&req)
+	if req.AvatarURL != nil && *req.AvatarURL != "" && !isHTTPURL(*req.AvatarURL) {
+		if fieldErrors == nil {
+			fieldErrors = map[string]string{}
+		}
+		fieldErrors["avatar_url"] = "avatar_url must be an http or https URL"
+	}
+	if fieldErrors != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": fieldErrors,
+		})
+	}
+
+	user, err := h.UserService.UpdateProfile(c.Request().Context(), userID, service.ProfileInput{
+		DisplayName: req.DisplayName,
+		Bio:         req.Bio,
+		AvatarURL:   req.AvatarURL,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+		}
+		h.Logger.Errorw("Error updating profile",
+			"error", err,
+			"user_id", userID,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	h.Logger.Infow("Profile updated",
+		"user_id", userID,
+		"status", http.StatusOK,
+	)
+	return c.JSON(http.StatusOK, user)
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+type roleRequest struct {
+	Role string `json:"role" validate:"required,oneof=user moderator admin"`
+}
+
+func (h *UserHandler) UpdateRole(c echo.Context) error {
+	adminID, err := middleware.GetUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "unauthorized"})
+	}
+	rawID := c.Param("id")
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		h.Logger.Errorw("Error parsing id param in UpdateRole",
+			"target_user_id", rawID,
+			"error", err,
+			"user_id", adminID,
+			"status", http.StatusBadRequest,
+		)
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid id"})
+	}
+	// Prevents the last admin from locking everyone out by accident
+	if id == adminID {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "you cannot change your own role"})
+	}
+
+	var req roleRequest
+	if err := c.Bind(&req); err != nil {
+		h.Logger.Errorw("Error binding role update request",
+			"target_user_id", id,
+			"error", err,
+			"user_id", adminID,
+			"status", http.StatusBadRequest,
+		)
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+
+	if fieldErrors := h.Validator.ValidateStruct(&req); fieldErrors != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "validation failed",
+			"fields": fieldErrors,
+		})
+	}
+
+	if err := h.UserService.UpdateRole(c.Request().Context(), id, model.Role(req.Role)); err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "user not found"})
+		}
+		h.Logger.Errorw("Error updating user role",
+			"target_user_id", id,
+			"error", err,
+			"user_id", adminID,
+			"status", http.StatusInternalServerError,
+		)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+
+	h.Logger.Infow("User role updated",
+		"target_user_id", id,
+		"role", req.Role,
+		"user_id", adminID,
+		"status", http.StatusOK,
+	)
+	return c.NoContent(http.StatusOK)
+}
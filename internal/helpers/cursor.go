@@ -0,0 +1,51 @@
+package helpers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"maxwellzp/blog-api/internal/model"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor is what an opaque cursor string decodes to. Clients must treat the
+// encoded form as a black box so the format can change.
+type cursor struct {
+	ID       int64 `json:"id"`
+	Backward bool  `json:"back,omitempty"`
+}
+
+func EncodeCursor(id int64, backward bool) string {
+	b, _ := json.Marshal(cursor{ID: id, Backward: backward})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// IsCursorRequest - Cursor mode is opted into with a cursor query parameter,
+// which is left empty for the first page.
+func IsCursorRequest(c echo.Context) bool {
+	return c.QueryParams().Has("cursor")
+}
+
+// GetKeyset decodes the cursor query parameter and reuses the limit rules of
+// GetPagination.
+func GetKeyset(c echo.Context) (model.Keyset, error) {
+	ks := model.Keyset{Limit: GetPagination(c).Limit}
+
+	raw := c.QueryParam("cursor")
+	if raw == "" {
+		return ks, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return ks, ErrInvalidCursor
+	}
+	var cur cursor
+	if err := json.Unmarshal(b, &cur); err != nil || cur.ID < 1 {
+		return ks, ErrInvalidCursor
+	}
+	ks.ID = cur.ID
+	ks.Backward = cur.Backward
+	return ks, nil
+}
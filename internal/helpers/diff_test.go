@@ -0,0 +1,90 @@
+package helpers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "equal",
+			a:    "one\ntwo",
+			b:    "one\ntwo",
+			want: "",
+		},
+		{
+			name: "changed line",
+			a:    "one\ntwo\nthree",
+			b:    "one\n2\nthree",
+			want: "--- a\n+++ b\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n",
+		},
+		{
+			name: "added at the end",
+			a:    "one",
+			b:    "one\ntwo",
+			want: "--- a\n+++ b\n@@ -1 +1,2 @@\n one\n+two\n",
+		},
+		{
+			name: "removed at the start",
+			a:    "one\ntwo",
+			b:    "two",
+			want: "--- a\n+++ b\n@@ -1,2 +1 @@\n-one\n two\n",
+		},
+		{
+			name: "added to empty",
+			a:    "",
+			b:    "one",
+			want: "--- a\n+++ b\n@@ -1 +1 @@\n-\n+one\n",
+		},
+		{
+			name: "distant changes make two hunks",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n10",
+			b:    "x\n2\n3\n4\n5\n6\n7\n8\n9\ny",
+			want: "--- a\n+++ b\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+y\n",
+		},
+		{
+			name: "close changes share a hunk",
+			a:    "1\n2\n3\n4\n5",
+			b:    "x\n2\n3\n4\ny",
+			want: "--- a\n+++ b\n@@ -1,5 +1,5 @@\n-1\n+x\n 2\n 3\n 4\n-5\n+y\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UnifiedDiff("a", "b", tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("UnifiedDiff: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("UnifiedDiff =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiffTooLarge(t *testing.T) {
+	var a, b strings.Builder
+	for i := 0; i < 2000; i++ {
+		a.WriteString("a\n")
+		b.WriteString("b\n")
+	}
+	if _, err := UnifiedDiff("a", "b", a.String(), b.String()); !errors.Is(err, ErrDiffTooLarge) {
+		t.Fatalf("UnifiedDiff error = %v, want ErrDiffTooLarge", err)
+	}
+
+	// A small edit in a long document only diffs the changed middle
+	long := strings.Repeat("same\n", 100000)
+	diff, err := UnifiedDiff("a", "b", long+"old\n"+long, long+"new\n"+long)
+	if err != nil {
+		t.Fatalf("UnifiedDiff: %v", err)
+	}
+	if !strings.Contains(diff, "-old\n+new\n") {
+		t.Errorf("unexpected diff %q", diff)
+	}
+}
@@ -0,0 +1,27 @@
+package helpers
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"slices"
+	"strings"
+)
+
+// GetExpand parses the comma separated expand query parameter, e.g.
+// ?expand=author,blog. Values outside allowed are rejected.
+func GetExpand(c echo.Context, allowed ...string) (map[string]bool, error) {
+	expand := map[string]bool{}
+	raw := c.QueryParam("expand")
+	if raw == "" {
+		return expand, nil
+	}
+
+	for _, value := range strings.Split(raw, ",") {
+		value = strings.TrimSpace(value)
+		if !slices.Contains(allowed, value) {
+			return nil, fmt.Errorf("expand must be any of: %s", strings.Join(allowed, " "))
+		}
+		expand[value] = true
+	}
+	return expand, nil
+}
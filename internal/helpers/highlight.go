@@ -0,0 +1,84 @@
+package helpers
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type span struct {
+	start, end int
+}
+
+// Highlight cuts a window of roughly width runes around the first match of
+// any term and wraps every match in <mark></mark>. The text itself is
+// HTML-escaped, so the snippet is safe to render as HTML.
+func Highlight(text string, terms []string, width int) string {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	var matches []span
+	for _, term := range terms {
+		t := []rune(strings.ToLower(term))
+		if len(t) == 0 {
+			continue
+		}
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if string(lower[i:i+len(t)]) == string(t) {
+				matches = append(matches, span{i, i + len(t)})
+				i += len(t) - 1
+			}
+		}
+	}
+	matches = mergeSpans(matches)
+
+	start := 0
+	if len(matches) > 0 {
+		start = max(matches[0].start-width/3, 0)
+	}
+	end := min(start+width, len(runes))
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("...")
+	}
+	pos := start
+	for _, m := range matches {
+		if m.end <= pos || m.start >= end {
+			continue
+		}
+		ms, me := max(m.start, pos), min(m.end, end)
+		b.WriteString(html.EscapeString(string(runes[pos:ms])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(runes[ms:me])))
+		b.WriteString("</mark>")
+		pos = me
+	}
+	b.WriteString(html.EscapeString(string(runes[pos:end])))
+	if end < len(runes) {
+		b.WriteString("...")
+	}
+	return b.String()
+}
+
+func mergeSpans(spans []span) []span {
+	if len(spans) == 0 {
+		return nil
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	merged := []span{spans[0]}
+	for _, s := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if s.start <= last.end {
+			last.end = max(last.end, s.end)
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
@@ -1,8 +1,11 @@
 package helpers
 
 import (
+	"fmt"
 	"github.com/labstack/echo/v4"
+	"maxwellzp/blog-api/internal/model"
 	"strconv"
+	"strings"
 )
 
 type Pagination struct {
@@ -33,3 +36,44 @@ func GetPagination(c echo.Context) Pagination {
 		Offset: offset,
 	}
 }
+
+// NewPage wraps one page of items together with the paging metadata
+func NewPage[T any](items []T, p Pagination, total int64) model.Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return model.Page[T]{
+		Items:   items,
+		Page:    p.Page,
+		Limit:   p.Limit,
+		Total:   total,
+		HasMore: int64(p.Offset+len(items)) < total,
+	}
+}
+
+// SetLinkHeader adds RFC 8288 first/prev/next/last links that keep every
+// other query parameter of the current request.
+func SetLinkHeader(c echo.Context, p Pagination, total int64) {
+	lastPage := int((total + int64(p.Limit) - 1) / int64(p.Limit))
+	if lastPage < 1 {
+		lastPage = 1
+	}
+
+	link := func(page int, rel string) string {
+		query := c.Request().URL.Query()
+		query.Set("page", strconv.Itoa(page))
+		query.Set("limit", strconv.Itoa(p.Limit))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, c.Request().URL.Path, query.Encode(), rel)
+	}
+
+	links := []string{link(1, "first")}
+	if p.Page > 1 {
+		links = append(links, link(min(p.Page-1, lastPage), "prev"))
+	}
+	if p.Page < lastPage {
+		links = append(links, link(p.Page+1, "next"))
+	}
+	links = append(links, link(lastPage, "last"))
+
+	c.Response().Header().Set("Link", strings.Join(links, ", "))
+}
@@ -0,0 +1,207 @@
+// Package jwtkeys holds the keys used to sign and verify access tokens.
+//
+// Without a key directory, tokens are signed with HS256 and the shared
+// secret. With one, every *.pem file in it is a key named after the file,
+// which becomes the "kid" header of the tokens it signs:
+//
+//   - private keys (RSA for RS256, Ed25519 for EdDSA) can sign, and their
+//     public halves verify
+//   - public keys only verify, which is how a retired key keeps accepting
+//     tokens issued before a rotation until they expire
+//
+// All verification keys are published as a JWK set, so other services can
+// verify tokens without any secret.
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Smallest RSA key accepted for signing or verifying
+const minRSABits = 2048
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+type key struct {
+	id     string
+	method jwt.SigningMethod
+	public crypto.PublicKey
+	// nil for keys that only verify
+	private crypto.Signer
+}
+
+type KeySet struct {
+	// nil when tokens are signed with secret
+	signing *key
+	keys    map[string]*key
+	secret  []byte
+}
+
+// NewHMAC returns a key set that signs and verifies with HS256 only
+func NewHMAC(secret string) *KeySet {
+	return &KeySet{secret: []byte(secret)}
+}
+
+// Load reads the keys in dir. signingKeyID may be empty when dir holds
+// exactly one private key.
+func Load(dir, signingKeyID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	set := &KeySet{keys: make(map[string]*key)}
+	var signers []string
+	for _, path := range paths {
+		k, err := loadKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", path, err)
+		}
+		set.keys[k.id] = k
+		if k.private != nil {
+			signers = append(signers, k.id)
+		}
+	}
+
+	if signingKeyID == "" {
+		if len(signers) != 1 {
+			return nil, fmt.Errorf("%d private keys in %s, choose the signing key by id", len(signers), dir)
+		}
+		signingKeyID = signers[0]
+	}
+	signing, ok := set.keys[signingKeyID]
+	if !ok || signing.private == nil {
+		return nil, fmt.Errorf("no private key %q in %s", signingKeyID, dir)
+	}
+	set.signing = signing
+	return set, nil
+}
+
+func loadKey(path string) (*key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+
+	k := &key{id: strings.TrimSuffix(filepath.Base(path), ".pem")}
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.method, k.public, k.private = jwt.SigningMethodRS256, &v.PublicKey, v
+	case *rsa.PublicKey:
+		k.method, k.public = jwt.SigningMethodRS256, v
+	case ed25519.PrivateKey:
+		k.method, k.public, k.private = jwt.SigningMethodEdDSA, v.Public(), v
+	case ed25519.PublicKey:
+		k.method, k.public = jwt.SigningMethodEdDSA, v
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", parsed)
+	}
+	if rsaKey, ok := k.public.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("RSA key has %d bits, at least %d are needed", rsaKey.N.BitLen(), minRSABits)
+	}
+	return k, nil
+}
+
+// Sign signs claims with the current signing key
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if s.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	}
+	token := jwt.NewWithClaims(s.signing.method, claims)
+	token.Header["kid"] = s.signing.id
+	return token.SignedString(s.signing.private)
+}
+
+// Keyfunc is passed to jwt.Parse. A token is only accepted with the
+// algorithm of the key it names, so a public key can never be used as an
+// HMAC secret.
+func (s *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if s.signing == nil {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return s.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	k, ok := s.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return k.public, nil
+}
+
+// JWK is a public key in the format of RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 (RFC 8037)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the verification keys ordered by id. It is empty with HMAC
+// signing, whose secret must never be published.
+func (s *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(s.keys))}
+	for _, k := range s.keys {
+		jwk := JWK{Kid: k.id, Use: "sig", Alg: k.method.Alg()}
+		switch pub := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	slices.SortFunc(set.Keys, func(a, b JWK) int { return strings.Compare(a.Kid, b.Kid) })
+	return set
+}
@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// OutboxMailer is meant for local development: instead of sending anything it
+// writes every message to a .eml file in dir, or to the log when dir is empty.
+type OutboxMailer struct {
+	dir    string
+	from   string
+	logger *zap.SugaredLogger
+}
+
+func NewOutboxMailer(dir, from string, logger *zap.SugaredLogger) *OutboxMailer {
+	return &OutboxMailer{dir: dir, from: from, logger: logger}
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._@-]`)
+
+func (m *OutboxMailer) Send(ctx context.Context, msg Message) error {
+	if m.dir == "" {
+		m.logger.Infow("Outbox email",
+			"to", msg.To,
+			"subject", msg.Subject,
+			"body", msg.Body,
+		)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0o750); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, format(m.from, msg), 0o640); err != nil {
+		return err
+	}
+
+	m.logger.Infow("Outbox email written",
+		"to", msg.To,
+		"subject", msg.Subject,
+		"path", path,
+	)
+	return nil
+}
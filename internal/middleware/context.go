@@ -3,6 +3,7 @@ package middleware
 import (
 	"errors"
 	"github.com/labstack/echo/v4"
+	"maxwellzp/blog-api/internal/model"
 )
 
 var ErrUserIDNotFound = errors.New("user_id not found in context")
@@ -20,3 +21,31 @@ func GetUserID(c echo.Context) (int64, error) {
 
 	return userID, nil
 }
+
+// GetRole falls back to the least privileged role when none is set
+func GetRole(c echo.Context) model.Role {
+	role, ok := c.Get(RoleContextKey).(model.Role)
+	if !ok {
+		return model.RoleUser
+	}
+	return role
+}
+
+func IsEmailVerified(c echo.Context) bool {
+	verified, _ := c.Get(EmailVerifiedContextKey).(bool)
+	return verified
+}
+
+// GetPersonalAccessToken returns nil when the request was authenticated
+// with a regular access token.
+func GetPersonalAccessToken(c echo.Context) *model.PersonalAccessToken {
+	token, _ := c.Get(PersonalAccessTokenContextKey).(*model.PersonalAccessToken)
+	return token
+}
+
+// GetSessionID returns 0 for requests not authenticated with a session's
+// access token.
+func GetSessionID(c echo.Context) int64 {
+	id, _ := c.Get(SessionIDContextKey).(int64)
+	return id
+}
@@ -1,16 +1,46 @@
 package middleware
 
 import (
+	"context"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
+	"maxwellzp/blog-api/internal/jwtkeys"
+	"maxwellzp/blog-api/internal/model"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
-const UserIDContextKey = "user_id"
+const (
+	UserIDContextKey              = "user_id"
+	RoleContextKey                = "role"
+	EmailVerifiedContextKey       = "email_verified"
+	PersonalAccessTokenContextKey = "personal_access_token"
+	SessionIDContextKey           = "session_id"
+)
+
+// TokenAuthenticator resolves personal access tokens, which are opaque and
+// have to be looked up instead of verified like a JWT.
+type TokenAuthenticator interface {
+	Authenticate(ctx context.Context, token string) (*model.User, *model.PersonalAccessToken, error)
+}
+
+// SessionChecker reports whether the session an access token was issued for
+// is still active, i.e. has not been signed out.
+type SessionChecker interface {
+	IsActive(ctx context.Context, id int64) (bool, error)
+}
 
-func JWTMiddleware(secret string, logger *zap.SugaredLogger) echo.MiddlewareFunc {
+// JWTMiddleware accepts both access tokens and personal access tokens as
+// bearer tokens. Use RequireScope and RequireSession to limit what a personal
+// access token can reach.
+func JWTMiddleware(
+	keys *jwtkeys.KeySet,
+	tokens TokenAuthenticator,
+	sessions SessionChecker,
+	logger *zap.SugaredLogger,
+) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			authHeader := c.Request().Header.Get("Authorization")
@@ -19,13 +49,11 @@ func JWTMiddleware(secret string, logger *zap.SugaredLogger) echo.MiddlewareFunc
 			}
 
 			tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-			token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-				// Only HMAC is supported
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, jwt.ErrSignatureInvalid
-				}
-				return []byte(secret), nil
-			})
+			if strings.HasPrefix(tokenStr, model.PersonalAccessTokenPrefix) {
+				return authenticatePersonalAccessToken(c, next, tokens, tokenStr, logger)
+			}
+
+			token, err := jwt.Parse(tokenStr, keys.Keyfunc)
 			if err != nil || !token.Valid {
 				logger.Warnw("Invalid JWT", "error", err)
 				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid token"})
@@ -41,8 +69,81 @@ func JWTMiddleware(secret string, logger *zap.SugaredLogger) echo.MiddlewareFunc
 				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "user_id not found in token"})
 			}
 
+			// Tokens issued before roles existed carry no role claim
+			role := model.RoleUser
+			if r, ok := claims["role"].(string); ok && r != "" {
+				role = model.Role(r)
+			}
+
+			// Missing on tokens issued before email verification existed
+			emailVerified, _ := claims["email_verified"].(bool)
+
+			// Tokens issued before sessions existed carry no jti and are
+			// accepted until they expire
+			if jti, ok := claims["jti"].(string); ok {
+				sessionID, err := strconv.ParseInt(jti, 10, 64)
+				if err != nil {
+					return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid token claims"})
+				}
+				active, err := sessions.IsActive(c.Request().Context(), sessionID)
+				if err != nil {
+					logger.Errorw("Error checking session", "error", err, "session_id", sessionID)
+					return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+				}
+				if !active {
+					return c.JSON(http.StatusUnauthorized, echo.Map{"error": "session has been revoked"})
+				}
+				c.Set(SessionIDContextKey, sessionID)
+			}
+
 			c.Set(UserIDContextKey, int64(userID))
+			c.Set(RoleContextKey, role)
+			c.Set(EmailVerifiedContextKey, emailVerified)
 			return next(c)
 		}
 	}
 }
+
+func authenticatePersonalAccessToken(
+	c echo.Context,
+	next echo.HandlerFunc,
+	tokens TokenAuthenticator,
+	tokenStr string,
+	logger *zap.SugaredLogger,
+) error {
+	if tokens == nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid token"})
+	}
+
+	user, token, err := tokens.Authenticate(c.Request().Context(), tokenStr)
+	if err != nil {
+		logger.Warnw("Invalid personal access token", "error", err)
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid token"})
+	}
+
+	c.Set(UserIDContextKey, user.ID)
+	c.Set(RoleContextKey, user.Role)
+	c.Set(EmailVerifiedContextKey, user.EmailVerified())
+	c.Set(PersonalAccessTokenContextKey, token)
+	return next(c)
+}
+
+// OptionalJWTMiddleware lets anonymous requests through but still rejects a
+// bearer token that is present and invalid.
+func OptionalJWTMiddleware(
+	keys *jwtkeys.KeySet,
+	tokens TokenAuthenticator,
+	sessions SessionChecker,
+	logger *zap.SugaredLogger,
+) echo.MiddlewareFunc {
+	required := JWTMiddleware(keys, tokens, sessions, logger)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		authenticated := required(next)
+		return func(c echo.Context) error {
+			if c.Request().Header.Get("Authorization") == "" {
+				return next(c)
+			}
+			return authenticated(c)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"maxwellzp/blog-api/internal/model"
+	"net/http"
+)
+
+// RequirePermission takes one of the model.Role permission methods, e.g.
+// model.Role.CanManageUsers. Must run after JWTMiddleware.
+func RequirePermission(allowed func(model.Role) bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !allowed(GetRole(c)) {
+				return c.JSON(http.StatusForbidden, echo.Map{"error": "insufficient permissions"})
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"maxwellzp/blog-api/internal/model"
+	"net/http"
+)
+
+// RequireScope must run after JWTMiddleware. Regular access tokens are not
+// limited by scopes, only personal access tokens are.
+func RequireScope(scope model.Scope) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if token := GetPersonalAccessToken(c); token != nil && !token.HasScope(scope) {
+				return c.JSON(http.StatusForbidden, echo.Map{
+					"error": "token is missing the " + string(scope) + " scope",
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireSession keeps personal access tokens away from account management,
+// so a leaked token cannot be used to take over the account.
+func RequireSession() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if GetPersonalAccessToken(c) != nil {
+				return c.JSON(http.StatusForbidden, echo.Map{"error": "not allowed with a personal access token"})
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+// RequireVerifiedEmail must run after JWTMiddleware. The check uses the
+// access token, so after verifying, clients have to refresh their token.
+func RequireVerifiedEmail() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !IsEmailVerified(c) {
+				return c.JSON(http.StatusForbidden, echo.Map{"error": "email address is not verified"})
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// AccountExport is everything stored about a user that they can download
+type AccountExport struct {
+	ExportedAt time.Time          `json:"exported_at"`
+	Profile    *User              `json:"profile"`
+	Blogs      []*ExportedBlog    `json:"blogs"`
+	Comments   []*ExportedComment `json:"comments"`
+}
+
+// ExportedBlog includes blogs in the trash, which have DeletedAt set
+type ExportedBlog struct {
+	Blog
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at"`
+}
+
+type ExportedComment struct {
+	Comment
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -1,8 +1,78 @@
 package model
 
+import (
+	"strings"
+	"time"
+)
+
+type BlogStatus string
+
+const (
+	BlogStatusDraft     BlogStatus = "draft"
+	BlogStatusScheduled BlogStatus = "scheduled"
+	BlogStatusPublished BlogStatus = "published"
+	BlogStatusArchived  BlogStatus = "archived"
+)
+
 type Blog struct {
-	ID      int64  `json:"id"`
-	Title   string `json:"title"`
-	UserID  int64  `json:"user_id"`
-	Content string `json:"content"`
+	ID          int64      `json:"id"`
+	Title       string     `json:"title"`
+	UserID      int64      `json:"user_id"`
+	Content     string     `json:"content"`
+	Status      BlogStatus `json:"status"`
+	PublishAt   *time.Time `json:"publish_at"`
+	PublishedAt *time.Time `json:"published_at"`
+	Tags        []string   `json:"tags"`
+	Version     int        `json:"version"`
+	// Only set with ?expand=author
+	Author *AuthorSummary `json:"author,omitempty"`
+}
+
+// BlogSummary is embedded in comments listed with ?expand=blog
+type BlogSummary struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+// BlogFilter narrows down blog listings. Zero values mean "no filter".
+type BlogFilter struct {
+	ViewerID      int64
+	Tag           string
+	AuthorID      int64
+	TitlePrefix   string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Sort          BlogSort
+}
+
+// BlogSort is a sort field, optionally prefixed with "-" for descending order.
+// The empty value keeps the default newest-first order.
+type BlogSort string
+
+var blogSortFields = []string{"created_at", "title", "comments_count"}
+
+// BlogSortFields lists the fields a blog listing can be sorted by
+func BlogSortFields() []string {
+	return blogSortFields
+}
+
+// Field returns the sort field without the direction prefix
+func (s BlogSort) Field() string {
+	return strings.TrimPrefix(string(s), "-")
+}
+
+func (s BlogSort) Descending() bool {
+	return strings.HasPrefix(string(s), "-")
+}
+
+func (s BlogSort) Valid() bool {
+	if s == "" {
+		return true
+	}
+	for _, f := range blogSortFields {
+		if s.Field() == f {
+			return true
+		}
+	}
+	return false
 }
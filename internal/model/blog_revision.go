@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+type BlogRevision struct {
+	ID        int64     `json:"-"`
+	BlogID    int64     `json:"blog_id"`
+	Revision  int       `json:"revision"`
+	UserID    *int64    `json:"user_id"` // nil once the author's account is deleted
+	Title     string    `json:"title"`
+	Content   string    `json:"content,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
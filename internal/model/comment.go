@@ -1,8 +1,15 @@
 package model
 
 type Comment struct {
-	ID      int64  `json:"id"`
-	UserID  int64  `json:"user_id"`
-	BlogID  int64  `json:"blog_id"`
-	Content string `json:"content"`
+	ID       int64  `json:"id"`
+	UserID   int64  `json:"user_id"`
+	BlogID   int64  `json:"blog_id"`
+	ParentID *int64 `json:"parent_id"`
+	Content  string `json:"content"`
+	Version  int    `json:"version"`
+	// Only set with ?expand=author and ?expand=blog respectively
+	Author *AuthorSummary `json:"author,omitempty"`
+	Blog   *BlogSummary   `json:"blog,omitempty"`
+	// Replies is only filled in the threaded listing
+	Replies []*Comment `json:"replies,omitempty"`
 }
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// LoginAttempt tracks failed logins per email, whether or not an account
+// exists for it, so that lockouts do not reveal registered addresses.
+type LoginAttempt struct {
+	Email        string
+	FailedCount  int
+	LastFailedAt time.Time
+	LockedUntil  *time.Time
+}
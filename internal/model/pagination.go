@@ -0,0 +1,26 @@
+package model
+
+// Keyset selects a page of rows relative to a row id: rows older than ID, or
+// newer than ID when Backward is set. ID 0 starts at the newest row.
+type Keyset struct {
+	ID       int64
+	Backward bool
+	Limit    int
+}
+
+// CursorPage is the response of a cursor-paginated listing. A nil cursor
+// means there is nothing more in that direction.
+type CursorPage[T any] struct {
+	Items      []T     `json:"items"`
+	NextCursor *string `json:"next_cursor"`
+	PrevCursor *string `json:"prev_cursor"`
+}
+
+// Page is the response of an offset-paginated listing
+type Page[T any] struct {
+	Items   []T   `json:"items"`
+	Page    int   `json:"page"`
+	Limit   int   `json:"limit"`
+	Total   int64 `json:"total"`
+	HasMore bool  `json:"has_more"`
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"slices"
+	"time"
+)
+
+// Scope limits what a personal access token may do
+type Scope string
+
+const (
+	ScopeRead          Scope = "read"
+	ScopeBlogsWrite    Scope = "blogs:write"
+	ScopeCommentsWrite Scope = "comments:write"
+)
+
+// PersonalAccessTokenPrefix starts every personal access token, which tells
+// them apart from JWTs and makes leaked tokens easy to scan for.
+const PersonalAccessTokenPrefix = "bpat_"
+
+type PersonalAccessToken struct {
+	ID     int64  `json:"id"`
+	UserID int64  `json:"-"`
+	Name   string `json:"name"`
+	// Prefix is the start of the token, enough to recognise it in a list
+	Prefix     string     `json:"prefix"`
+	TokenHash  string     `json:"-"`
+	Scopes     []Scope    `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// HasScope - Every scope includes read access
+func (t *PersonalAccessToken) HasScope(scope Scope) bool {
+	return (scope == ScopeRead && len(t.Scopes) > 0) || slices.Contains(t.Scopes, scope)
+}
@@ -0,0 +1,18 @@
+package model
+
+const (
+	SearchResultBlog    = "blog"
+	SearchResultComment = "comment"
+)
+
+// SearchResult is a single hit from GET /search. For comments, BlogTitle is
+// the title of the blog the comment belongs to.
+type SearchResult struct {
+	Type      string  `json:"type"`
+	ID        int64   `json:"id"`
+	BlogID    int64   `json:"blog_id"`
+	BlogTitle string  `json:"blog_title"`
+	Snippet   string  `json:"snippet"`
+	Score     float64 `json:"score"`
+	Content   string  `json:"-"`
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// Session is one login on one device. It shares its lifetime with the
+// refresh token family started by the login, and its id is the "jti" of the
+// access tokens issued for it.
+type Session struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"-"`
+	FamilyID   string     `json:"-"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"-"`
+	// Current marks the session of the request that listed the sessions
+	Current bool `json:"current"`
+}
@@ -0,0 +1,6 @@
+package model
+
+type Tag struct {
+	Name      string `json:"name"`
+	PostCount int64  `json:"post_count"`
+}
@@ -1,8 +1,90 @@
 package model
 
+import "time"
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// CanManageBlogs - Admins may edit or delete any blog regardless of owner
+func (r Role) CanManageBlogs() bool {
+	return r == RoleAdmin
+}
+
+// CanModerateComments - Moderators and admins may edit or delete any comment
+func (r Role) CanModerateComments() bool {
+	return r == RoleModerator || r == RoleAdmin
+}
+
+// CanManageUsers - Only admins may change the roles of other users
+func (r Role) CanManageUsers() bool {
+	return r == RoleAdmin
+}
+
 type User struct {
-	ID       int64  `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"-"`
+	ID          int64     `json:"id"`
+	Username    string    `json:"username"`
+	Email       string    `json:"email"`
+	Password    string    `json:"-"`
+	Role        Role      `json:"role"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarURL   string    `json:"avatar_url"`
+	CreatedAt   time.Time `json:"created_at"`
+	// nil until the user follows the link from the verification email
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// TOTPSecret is set on enrollment, 2FA is only on once TOTPEnabledAt is set
+	TOTPSecret    string     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at"`
+	// Last time step a code was accepted for, to refuse replays
+	TOTPLastStep int64 `json:"-"`
+	// Set while a requested account deletion waits for its grace period
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+	// Set once the account has been anonymized
+	DeletedAt *time.Time `json:"-"`
+}
+
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+// Deleted - The account was deleted or is about to be, so it may not be used
+func (u *User) Deleted() bool {
+	return u.DeletionScheduledAt != nil || u.DeletedAt != nil
+}
+
+// AuthorSummary is embedded in blogs and comments listed with ?expand=author
+type AuthorSummary struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+// PublicProfile is the part of a user that anyone may see
+type PublicProfile struct {
+	ID          int64     `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarURL   string    `json:"avatar_url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (u *User) PublicProfile() *PublicProfile {
+	return &PublicProfile{
+		ID:          u.ID,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		Bio:         u.Bio,
+		AvatarURL:   u.AvatarURL,
+		CreatedAt:   u.CreatedAt,
+	}
 }
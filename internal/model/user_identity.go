@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// UserIdentity links a user to an account at an external OpenID Connect
+// provider, identified by the provider's subject claim.
+type UserIdentity struct {
+	ID       int64  `json:"id"`
+	UserID   int64  `json:"user_id"`
+	Provider string `json:"provider"`
+	Subject  string `json:"-"`
+	// Email as reported by the provider when the identity was linked
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,137 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"maxwellzp/blog-api/internal/oidc/oidctest"
+	"net/url"
+	"testing"
+)
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Server) {
+	t.Helper()
+	srv := oidctest.NewServer(t)
+	p := NewProvider(Config{
+		Issuer:       srv.Issuer(),
+		ClientID:     srv.ClientID,
+		ClientSecret: srv.ClientSecret,
+		RedirectURL:  "http://localhost:8080/auth/oidc/mock/callback",
+	})
+	return p, srv
+}
+
+// authorize runs the flow up to the redirect back from the provider
+func authorize(t *testing.T, p *Provider, srv *oidctest.Server, verifier, nonce string, identity oidctest.Identity) string {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(context.Background(), "state-1", nonce, CodeChallenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, state := srv.Authorize(t, authURL, identity)
+	if state != "state-1" {
+		t.Fatalf("state = %q, want state-1", state)
+	}
+	return code
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// RFC 7636, appendix B
+	got := CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Errorf("CodeChallenge = %q, want %q", got, want)
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	p, srv := newTestProvider(t)
+	authURL, err := p.AuthCodeURL(context.Background(), "state-1", "nonce-1", "challenge-1")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             srv.ClientID,
+		"scope":                 "openid email profile",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        "challenge-1",
+		"code_challenge_method": "S256",
+	}
+	for key, value := range want {
+		if got := q.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	p, srv := newTestProvider(t)
+	verifier, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := authorize(t, p, srv, verifier, "nonce-1", oidctest.Identity{
+		Subject:       "subject-1",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		Name:          "Jane Doe",
+	})
+
+	claims, err := p.Exchange(context.Background(), code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "jane@example.com" || !claims.EmailVerified || claims.Name != "Jane Doe" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+}
+
+func TestExchangeRejectsWrongCodeVerifier(t *testing.T) {
+	p, srv := newTestProvider(t)
+	verifier, _ := NewCodeVerifier()
+	other, _ := NewCodeVerifier()
+	code := authorize(t, p, srv, verifier, "nonce-1", oidctest.Identity{Subject: "subject-1"})
+
+	_, err := p.Exchange(context.Background(), code, other, "nonce-1")
+	if !errors.Is(err, ErrTokenRequest) {
+		t.Fatalf("Exchange error = %v, want ErrTokenRequest", err)
+	}
+}
+
+func TestExchangeRejectsReusedCode(t *testing.T) {
+	p, srv := newTestProvider(t)
+	verifier, _ := NewCodeVerifier()
+	code := authorize(t, p, srv, verifier, "nonce-1", oidctest.Identity{Subject: "subject-1"})
+
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce-1"); err != nil {
+		t.Fatalf("first Exchange: %v", err)
+	}
+	if _, err := p.Exchange(context.Background(), code, verifier, "nonce-1"); !errors.Is(err, ErrTokenRequest) {
+		t.Fatalf("second Exchange error = %v, want ErrTokenRequest", err)
+	}
+}
+
+func TestExchangeRejectsNonceMismatch(t *testing.T) {
+	p, srv := newTestProvider(t)
+	verifier, _ := NewCodeVerifier()
+	code := authorize(t, p, srv, verifier, "nonce-1", oidctest.Identity{Subject: "subject-1", Nonce: "replayed"})
+
+	_, err := p.Exchange(context.Background(), code, verifier, "nonce-1")
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("Exchange error = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestDiscoveryRejectsOtherIssuer(t *testing.T) {
+	srv := oidctest.NewServer(t)
+	p := NewProvider(Config{Issuer: srv.Issuer() + "/", ClientID: srv.ClientID})
+
+	if _, err := p.AuthCodeURL(context.Background(), "state", "nonce", "challenge"); err == nil {
+		t.Fatal("AuthCodeURL accepted a discovery document for another issuer")
+	}
+}
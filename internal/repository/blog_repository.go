@@ -4,17 +4,41 @@ import (
 	"context"
 	"database/sql"
 	"maxwellzp/blog-api/internal/model"
+	"slices"
+	"strings"
 	"time"
 )
 
 type BlogRepository interface {
 	Create(ctx context.Context, blog *model.Blog) error
 	GetByID(ctx context.Context, id int64) (*model.Blog, error)
-	Update(ctx context.Context, blog *model.Blog) error
-	Delete(ctx context.Context, id int64) error
-	List(ctx context.Context, limit, offset int) ([]*model.Blog, error)
+	GetVisibleByID(ctx context.Context, id, viewerID int64) (*model.Blog, error)
+	Update(ctx context.Context, blog *model.Blog, editorID int64, expectedVersion int) error
+	UpdateStatus(ctx context.Context, id int64, status model.BlogStatus, expectedVersion int) (int, error)
+	PublishDue(ctx context.Context, now time.Time) (int64, error)
+	Delete(ctx context.Context, id int64, expectedVersion int) error
+	List(ctx context.Context, filter model.BlogFilter, limit, offset int) ([]*model.Blog, error)
+	ListByKeyset(ctx context.Context, filter model.BlogFilter, ks model.Keyset) ([]*model.Blog, error)
+	Count(ctx context.Context, filter model.BlogFilter) (int64, error)
+	ListSummariesByIDs(ctx context.Context, ids []int64, viewerID int64) (map[int64]*model.BlogSummary, error)
+	GetDeletedByID(ctx context.Context, id int64) (*model.Blog, error)
+	ListDeletedByUserID(ctx context.Context, userID int64, limit, offset int) ([]*model.Blog, error)
+	Restore(ctx context.Context, id int64, expectedVersion int) (int, error)
+	PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (int64, error)
+	ListForExport(ctx context.Context, userID int64) ([]*model.ExportedBlog, error)
 }
 
+const blogColumns = "id, user_id, title, content, status, publish_at, published_at, version"
+
+// matchesVersion guards conditional writes. It takes the expected version
+// twice; 0 means the caller accepts any version.
+const matchesVersion = "(? = 0 OR version = ?)"
+
+// visibleToViewer limits rows to published blogs plus the viewer's own
+// drafts, scheduled and archived posts. Anonymous viewers pass 0, which
+// matches no author.
+const visibleToViewer = "(status = 'published' OR user_id = ?)"
+
 type blogRepository struct {
 	db *sql.DB
 }
@@ -23,65 +47,375 @@ func NewBlogRepository(db *sql.DB) BlogRepository {
 	return &blogRepository{db: db}
 }
 
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanBlog(row rowScanner) (*model.Blog, error) {
+	blog := &model.Blog{}
+	if err := row.Scan(&blog.ID, &blog.UserID, &blog.Title, &blog.Content, &blog.Status, &blog.PublishAt, &blog.PublishedAt, &blog.Version); err != nil {
+		return nil, err
+	}
+	return blog, nil
+}
+
+// Create also records the blog's first revision and sets its tags, all in
+// one transaction
 func (r *blogRepository) Create(ctx context.Context, blog *model.Blog) error {
-	query := "INSERT INTO blog (user_id, title, content) VALUES(?, ?, ?)"
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	res, err := r.db.ExecContext(ctx, query, blog.UserID, blog.Title, blog.Content)
+	query := "INSERT INTO blog (user_id, title, content, status, publish_at, published_at) VALUES(?, ?, ?, ?, ?, ?)"
+
+	res, err := tx.ExecContext(ctx, query, blog.UserID, blog.Title, blog.Content, blog.Status, blog.PublishAt, blog.PublishedAt)
 	if err != nil {
 		return err
 	}
 
 	blog.ID, err = res.LastInsertId()
-	return err
+	if err != nil {
+		return err
+	}
+	if err := insertRevision(ctx, tx, blog.ID, blog.UserID, blog.Title, blog.Content); err != nil {
+		return err
+	}
+	if err := setBlogTags(ctx, tx, blog.ID, blog.Tags); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	blog.Version = 1
+	return nil
 }
 
+// GetByID ignores visibility and is meant for ownership and permission checks
 func (r *blogRepository) GetByID(ctx context.Context, id int64) (*model.Blog, error) {
-	query := "SELECT id, user_id, title, content FROM blog WHERE id = ? AND deleted_at IS NULL"
+	query := "SELECT " + blogColumns + " FROM blog WHERE id = ? AND deleted_at IS NULL"
 
-	row := r.db.QueryRowContext(ctx, query, id)
+	return scanBlog(r.db.QueryRowContext(ctx, query, id))
+}
 
-	blog := &model.Blog{}
-	if err := row.Scan(&blog.ID, &blog.UserID, &blog.Title, &blog.Content); err != nil {
-		return nil, err
+func (r *blogRepository) GetVisibleByID(ctx context.Context, id, viewerID int64) (*model.Blog, error) {
+	query := "SELECT " + blogColumns + " FROM blog WHERE id = ? AND deleted_at IS NULL AND " + visibleToViewer
+
+	return scanBlog(r.db.QueryRowContext(ctx, query, id, viewerID))
+}
+
+// Update writes the title and content and records them as a revision
+// authored by editorID. In the same transaction it schedules the blog when
+// PublishAt is set and replaces its tags when Tags is not nil. blog.Version
+// is set to the stored version.
+func (r *blogRepository) Update(ctx context.Context, blog *model.Blog, editorID int64, expectedVersion int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
-	return blog, nil
+	defer tx.Rollback()
+
+	// LAST_INSERT_ID(expr) hands the incremented version back through the
+	// result without a second query.
+	set := "title = ?, content = ?"
+	args := []any{blog.Title, blog.Content}
+	if blog.PublishAt != nil {
+		set += ", status = ?, publish_at = ?"
+		args = append(args, model.BlogStatusScheduled, *blog.PublishAt)
+	}
+	query := "UPDATE blog SET " + set + ", version = LAST_INSERT_ID(version + 1) " +
+		"WHERE id = ? AND deleted_at IS NULL AND " + matchesVersion
+	args = append(args, blog.ID, expectedVersion, expectedVersion)
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if err := checkVersionedWrite(ctx, tx, res, "SELECT 1 FROM blog WHERE id = ? AND deleted_at IS NULL", blog.ID); err != nil {
+		return err
+	}
+	version, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err := insertRevision(ctx, tx, blog.ID, editorID, blog.Title, blog.Content); err != nil {
+		return err
+	}
+	if blog.Tags != nil {
+		if err := setBlogTags(ctx, tx, blog.ID, blog.Tags); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	blog.Version = int(version)
+	return nil
 }
 
-func (r *blogRepository) Update(ctx context.Context, blog *model.Blog) error {
-	query := "UPDATE blog SET title = ?, content = ? WHERE id = ? AND deleted_at IS NULL"
+// UpdateStatus keeps the original published_at when a blog is published again.
+// Any pending schedule is dropped. Returns the new version like Update.
+func (r *blogRepository) UpdateStatus(ctx context.Context, id int64, status model.BlogStatus, expectedVersion int) (int, error) {
+	set := "status = ?, publish_at = NULL"
+	args := []any{status}
+	if status == model.BlogStatusPublished {
+		set += ", published_at = COALESCE(published_at, ?)"
+		args = append(args, time.Now())
+	}
+	query := "UPDATE blog SET " + set + ", version = LAST_INSERT_ID(version + 1) " +
+		"WHERE id = ? AND deleted_at IS NULL AND " + matchesVersion
+	args = append(args, id, expectedVersion, expectedVersion)
 
-	_, err := r.db.ExecContext(ctx, query, blog.Title, blog.Content, blog.ID)
-	return err
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkVersionedWrite(ctx, r.db, res, "SELECT 1 FROM blog WHERE id = ? AND deleted_at IS NULL", id); err != nil {
+		return 0, err
+	}
+	version, err := res.LastInsertId()
+	return int(version), err
 }
 
-func (r *blogRepository) Delete(ctx context.Context, id int64) error {
-	query := "UPDATE blog SET deleted_at = ? WHERE id = ?"
+// PublishDue publishes every scheduled blog whose publish_at has passed and
+// returns how many were published.
+func (r *blogRepository) PublishDue(ctx context.Context, now time.Time) (int64, error) {
+	query := "UPDATE blog SET status = ?, published_at = publish_at, publish_at = NULL, version = version + 1 " +
+		"WHERE status = ? AND publish_at <= ? AND deleted_at IS NULL"
 
-	_, err := r.db.ExecContext(ctx, query, time.Now(), id)
-	return err
+	res, err := r.db.ExecContext(ctx, query, model.BlogStatusPublished, model.BlogStatusScheduled, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
 }
 
-func (r *blogRepository) List(ctx context.Context, limit, offset int) ([]*model.Blog, error) {
-	query := "SELECT id, user_id, title, content " +
+func (r *blogRepository) Delete(ctx context.Context, id int64, expectedVersion int) error {
+	query := "UPDATE blog SET deleted_at = ?, version = version + 1 " +
+		"WHERE id = ? AND deleted_at IS NULL AND " + matchesVersion
+
+	res, err := r.db.ExecContext(ctx, query, time.Now(), id, expectedVersion, expectedVersion)
+	if err != nil {
+		return err
+	}
+	return checkVersionedWrite(ctx, r.db, res, "SELECT 1 FROM blog WHERE id = ? AND deleted_at IS NULL", id)
+}
+
+func (r *blogRepository) List(ctx context.Context, filter model.BlogFilter, limit, offset int) ([]*model.Blog, error) {
+	where, args := blogListWhere(filter)
+	query := "SELECT " + blogColumns + " " +
 		"FROM blog " +
-		"WHERE deleted_at IS NULL " +
-		"ORDER BY id DESC " +
+		"WHERE " + where + " " +
+		"ORDER BY " + blogListOrder(filter.Sort) + " " +
 		"LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanBlogs(rows)
+}
+
+// ListByKeyset returns up to ks.Limit blogs next to the cursor id, newest
+// first in both directions.
+func (r *blogRepository) ListByKeyset(ctx context.Context, filter model.BlogFilter, ks model.Keyset) ([]*model.Blog, error) {
+	where, args := blogListWhere(filter)
+	keyset, order, keysetArgs := keysetClause(ks)
+	query := "SELECT " + blogColumns + " " +
+		"FROM blog " +
+		"WHERE " + where + keyset + " " +
+		"ORDER BY id " + order + " " +
+		"LIMIT ?"
+	args = append(append(args, keysetArgs...), ks.Limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	blogs, err := scanBlogs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if ks.Backward {
+		slices.Reverse(blogs)
+	}
+	return blogs, nil
+}
+
+// Count returns how many blogs List would return across all pages
+func (r *blogRepository) Count(ctx context.Context, filter model.BlogFilter) (int64, error) {
+	where, args := blogListWhere(filter)
+	var total int64
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM blog WHERE "+where, args...).Scan(&total)
+	return total, err
+}
 
-	rows, err := r.db.QueryContext(ctx, query, limit, offset)
+// ListSummariesByIDs loads the titles of several blogs at once. Deleted blogs
+// and blogs the viewer may not see are left out.
+func (r *blogRepository) ListSummariesByIDs(ctx context.Context, ids []int64, viewerID int64) (map[int64]*model.BlogSummary, error) {
+	blogs := make(map[int64]*model.BlogSummary, len(ids))
+	if len(ids) == 0 {
+		return blogs, nil
+	}
 
+	args := make([]any, 0, len(ids)+1)
+	args = append(args, viewerID)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	query := "SELECT id, title FROM blog " +
+		"WHERE deleted_at IS NULL AND " + visibleToViewer + " AND id IN (" + repeatPlaceholders("?", len(ids)) + ")"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	for rows.Next() {
+		b := &model.BlogSummary{}
+		if err := rows.Scan(&b.ID, &b.Title); err != nil {
+			return nil, err
+		}
+		blogs[b.ID] = b
+	}
+	return blogs, rows.Err()
+}
+
+// blogListWhere builds the WHERE clause shared by the listing queries
+func blogListWhere(filter model.BlogFilter) (string, []any) {
+	where := "deleted_at IS NULL AND " + visibleToViewer
+	args := []any{filter.ViewerID}
+
+	if filter.Tag != "" {
+		where += " AND id IN (SELECT bt.blog_id FROM blog_tag bt JOIN tag t ON t.id = bt.tag_id WHERE t.name = ?)"
+		args = append(args, filter.Tag)
+	}
+	if filter.AuthorID != 0 {
+		where += " AND user_id = ?"
+		args = append(args, filter.AuthorID)
+	}
+	if filter.TitlePrefix != "" {
+		where += " AND title LIKE ?"
+		args = append(args, likeEscaper.Replace(filter.TitlePrefix)+"%")
+	}
+	if filter.CreatedAfter != nil {
+		where += " AND created_at >= ?"
+		args = append(args, *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		where += " AND created_at < ?"
+		args = append(args, *filter.CreatedBefore)
+	}
+	return where, args
+}
+
+// likeEscaper makes user input match literally inside a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// blogSortColumns whitelists the SQL behind every model.BlogSort field so
+// that nothing from the request ends up in ORDER BY.
+var blogSortColumns = map[string]string{
+	"created_at":     "created_at",
+	"title":          "title",
+	"comments_count": "(SELECT COUNT(*) FROM comment WHERE comment.blog_id = blog.id)",
+}
+
+// blogListOrder builds the ORDER BY clause for a listing. id is always the
+// tiebreaker so that pages are stable.
+func blogListOrder(sort model.BlogSort) string {
+	column, ok := blogSortColumns[sort.Field()]
+	if !ok {
+		return "id DESC"
+	}
+	if sort.Descending() {
+		return column + " DESC, id DESC"
+	}
+	return column + " ASC, id ASC"
+}
+
+func scanBlogs(rows *sql.Rows) ([]*model.Blog, error) {
+	defer rows.Close()
+
 	var blogs []*model.Blog
 	for rows.Next() {
-		blog := &model.Blog{}
-		if err := rows.Scan(&blog.ID, &blog.UserID, &blog.Title, &blog.Content); err != nil {
+		blog, err := scanBlog(rows)
+		if err != nil {
 			return nil, err
 		}
 		blogs = append(blogs, blog)
 	}
-	return blogs, nil
+	return blogs, rows.Err()
+}
+
+func (r *blogRepository) GetDeletedByID(ctx context.Context, id int64) (*model.Blog, error) {
+	query := "SELECT " + blogColumns + " FROM blog WHERE id = ? AND deleted_at IS NOT NULL"
+
+	return scanBlog(r.db.QueryRowContext(ctx, query, id))
+}
+
+func (r *blogRepository) ListDeletedByUserID(ctx context.Context, userID int64, limit, offset int) ([]*model.Blog, error) {
+	query := "SELECT " + blogColumns + " " +
+		"FROM blog " +
+		"WHERE user_id = ? AND deleted_at IS NOT NULL " +
+		"ORDER BY deleted_at DESC " +
+		"LIMIT ? OFFSET ?"
+
+	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanBlogs(rows)
+}
+
+func (r *blogRepository) Restore(ctx context.Context, id int64, expectedVersion int) (int, error) {
+	query := "UPDATE blog SET deleted_at = NULL, version = LAST_INSERT_ID(version + 1) " +
+		"WHERE id = ? AND deleted_at IS NOT NULL AND " + matchesVersion
+
+	res, err := r.db.ExecContext(ctx, query, id, expectedVersion, expectedVersion)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkVersionedWrite(ctx, r.db, res, "SELECT 1 FROM blog WHERE id = ? AND deleted_at IS NOT NULL", id); err != nil {
+		return 0, err
+	}
+	version, err := res.LastInsertId()
+	return int(version), err
+}
+
+// PurgeDeletedBefore hard-deletes blogs that were soft-deleted before cutoff.
+// Comments, tags and revisions go with them through ON DELETE CASCADE.
+func (r *blogRepository) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	query := "DELETE FROM blog WHERE deleted_at IS NOT NULL AND deleted_at < ?"
+
+	res, err := r.db.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ListForExport returns all of a user's blogs, including those in the trash
+func (r *blogRepository) ListForExport(ctx context.Context, userID int64) ([]*model.ExportedBlog, error) {
+	query := "SELECT " + blogColumns + ", created_at, deleted_at FROM blog WHERE user_id = ? ORDER BY id"
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blogs := []*model.ExportedBlog{}
+	for rows.Next() {
+		b := &model.ExportedBlog{}
+		err := rows.Scan(&b.ID, &b.UserID, &b.Title, &b.Content, &b.Status, &b.PublishAt, &b.PublishedAt, &b.Version,
+			&b.CreatedAt, &b.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		blogs = append(blogs, b)
+	}
+	return blogs, rows.Err()
 }
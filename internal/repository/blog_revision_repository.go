@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"maxwellzp/blog-api/internal/model"
+)
+
+// BlogRevisionRepository is read-only: revisions are written by
+// blogRepository in the same transaction as the blog itself.
+type BlogRevisionRepository interface {
+	ListByBlogID(ctx context.Context, blogID int64) ([]*model.BlogRevision, error)
+	Get(ctx context.Context, blogID int64, revision int) (*model.BlogRevision, error)
+}
+
+type blogRevisionRepository struct {
+	db *sql.DB
+}
+
+func NewBlogRevisionRepository(db *sql.DB) BlogRevisionRepository {
+	return &blogRevisionRepository{db: db}
+}
+
+// ListByBlogID leaves out the content to keep the history listing small
+func (r *blogRevisionRepository) ListByBlogID(ctx context.Context, blogID int64) ([]*model.BlogRevision, error) {
+	query := "SELECT id, blog_id, revision, user_id, title, created_at " +
+		"FROM blog_revision " +
+		"WHERE blog_id = ? " +
+		"ORDER BY revision DESC"
+
+	rows, err := r.db.QueryContext(ctx, query, blogID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*model.BlogRevision
+	for rows.Next() {
+		rev := &model.BlogRevision{}
+		if err := rows.Scan(&rev.ID, &rev.BlogID, &rev.Revision, &rev.UserID, &rev.Title, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+func (r *blogRevisionRepository) Get(ctx context.Context, blogID int64, revision int) (*model.BlogRevision, error) {
+	query := "SELECT id, blog_id, revision, user_id, title, content, created_at " +
+		"FROM blog_revision " +
+		"WHERE blog_id = ? AND revision = ?"
+
+	rev := &model.BlogRevision{}
+	err := r.db.QueryRowContext(ctx, query, blogID, revision).
+		Scan(&rev.ID, &rev.BlogID, &rev.Revision, &rev.UserID, &rev.Title, &rev.Content, &rev.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+// insertRevision appends the next revision number for a blog
+func insertRevision(ctx context.Context, tx *sql.Tx, blogID, userID int64, title, content string) error {
+	query := "INSERT INTO blog_revision (blog_id, revision, user_id, title, content) " +
+		"SELECT ?, COALESCE(MAX(revision), 0) + 1, ?, ?, ? FROM blog_revision WHERE blog_id = ?"
+
+	_, err := tx.ExecContext(ctx, query, blogID, userID, title, content, blogID)
+	return err
+}
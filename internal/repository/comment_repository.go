@@ -4,16 +4,26 @@ import (
 	"context"
 	"database/sql"
 	"maxwellzp/blog-api/internal/model"
+	"slices"
 )
 
 type CommentRepository interface {
 	Create(ctx context.Context, comment *model.Comment) error
 	GetByID(ctx context.Context, id int64) (*model.Comment, error)
-	Update(ctx context.Context, comment *model.Comment) error
-	Delete(ctx context.Context, id int64) error
+	Update(ctx context.Context, comment *model.Comment, expectedVersion int) error
+	Delete(ctx context.Context, id int64, expectedVersion int) error
 	ListByBlogID(ctx context.Context, blogID int64, limit, offset int) ([]*model.Comment, error)
+	ListByBlogIDKeyset(ctx context.Context, blogID int64, ks model.Keyset) ([]*model.Comment, error)
+	CountByBlogID(ctx context.Context, blogID int64) (int64, error)
+	ListRootsByBlogID(ctx context.Context, blogID int64, limit, offset int) ([]*model.Comment, error)
+	CountRootsByBlogID(ctx context.Context, blogID int64) (int64, error)
+	ListReplies(ctx context.Context, rootIDs []int64, maxDepth int) ([]*model.Comment, error)
+	Depth(ctx context.Context, id int64) (int, error)
+	ListForExport(ctx context.Context, userID int64) ([]*model.ExportedComment, error)
 }
 
+const commentColumns = "id, user_id, blog_id, parent_id, content, version"
+
 type commentRepository struct {
 	db *sql.DB
 }
@@ -22,42 +32,71 @@ func NewCommentRepository(db *sql.DB) CommentRepository {
 	return &commentRepository{db: db}
 }
 
+func scanComment(row rowScanner) (*model.Comment, error) {
+	c := &model.Comment{}
+	if err := row.Scan(&c.ID, &c.UserID, &c.BlogID, &c.ParentID, &c.Content, &c.Version); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func scanComments(rows *sql.Rows) ([]*model.Comment, error) {
+	defer rows.Close()
+
+	var comments []*model.Comment
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
 func (r *commentRepository) Create(ctx context.Context, comment *model.Comment) error {
-	query := "INSERT INTO comment (user_id, blog_id, content) VALUES (?, ?, ?)"
-	res, err := r.db.ExecContext(ctx, query, comment.UserID, comment.BlogID, comment.Content)
+	query := "INSERT INTO comment (user_id, blog_id, parent_id, content) VALUES (?, ?, ?, ?)"
+	res, err := r.db.ExecContext(ctx, query, comment.UserID, comment.BlogID, comment.ParentID, comment.Content)
 	if err != nil {
 		return err
 	}
 	comment.ID, err = res.LastInsertId()
+	comment.Version = 1
 	return err
 }
 
 func (r *commentRepository) GetByID(ctx context.Context, id int64) (*model.Comment, error) {
-	query := "SELECT id, user_id, blog_id, content FROM comment WHERE id = ?"
+	query := "SELECT " + commentColumns + " FROM comment WHERE id = ?"
 
-	row := r.db.QueryRowContext(ctx, query, id)
-
-	comment := &model.Comment{}
-	if err := row.Scan(&comment.ID, &comment.UserID, &comment.BlogID, &comment.Content); err != nil {
-		return nil, err
-	}
-	return comment, nil
+	return scanComment(r.db.QueryRowContext(ctx, query, id))
 }
 
-func (r *commentRepository) Update(ctx context.Context, comment *model.Comment) error {
-	query := "UPDATE comment SET content = ? WHERE id = ?"
-	_, err := r.db.ExecContext(ctx, query, comment.Content, comment.ID)
+// Update stores the new version in comment.Version, see blogRepository.Update
+func (r *commentRepository) Update(ctx context.Context, comment *model.Comment, expectedVersion int) error {
+	query := "UPDATE comment SET content = ?, version = LAST_INSERT_ID(version + 1) WHERE id = ? AND " + matchesVersion
+	res, err := r.db.ExecContext(ctx, query, comment.Content, comment.ID, expectedVersion, expectedVersion)
+	if err != nil {
+		return err
+	}
+	if err := checkVersionedWrite(ctx, r.db, res, "SELECT 1 FROM comment WHERE id = ?", comment.ID); err != nil {
+		return err
+	}
+	version, err := res.LastInsertId()
+	comment.Version = int(version)
 	return err
 }
 
-func (r *commentRepository) Delete(ctx context.Context, id int64) error {
-	query := "DELETE FROM comment WHERE id = ?"
-	_, err := r.db.ExecContext(ctx, query, id)
-	return err
+func (r *commentRepository) Delete(ctx context.Context, id int64, expectedVersion int) error {
+	query := "DELETE FROM comment WHERE id = ? AND " + matchesVersion
+	res, err := r.db.ExecContext(ctx, query, id, expectedVersion, expectedVersion)
+	if err != nil {
+		return err
+	}
+	return checkVersionedWrite(ctx, r.db, res, "SELECT 1 FROM comment WHERE id = ?", id)
 }
 
 func (r *commentRepository) ListByBlogID(ctx context.Context, blogID int64, limit, offset int) ([]*model.Comment, error) {
-	query := "SELECT id, user_id, blog_id, content " +
+	query := "SELECT " + commentColumns + " " +
 		"FROM comment " +
 		"WHERE blog_id = ?" +
 		" ORDER BY id DESC " +
@@ -67,15 +106,132 @@ func (r *commentRepository) ListByBlogID(ctx context.Context, blogID int64, limi
 	if err != nil {
 		return nil, err
 	}
+	return scanComments(rows)
+}
+
+// ListByBlogIDKeyset is the cursor-paginated ListByBlogID, see
+// blogRepository.ListByKeyset.
+func (r *commentRepository) ListByBlogIDKeyset(ctx context.Context, blogID int64, ks model.Keyset) ([]*model.Comment, error) {
+	keyset, order, keysetArgs := keysetClause(ks)
+	query := "SELECT " + commentColumns + " " +
+		"FROM comment " +
+		"WHERE blog_id = ?" + keyset + " " +
+		"ORDER BY id " + order + " " +
+		"LIMIT ?"
+	args := append(append([]any{blogID}, keysetArgs...), ks.Limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := scanComments(rows)
+	if err != nil {
+		return nil, err
+	}
+	if ks.Backward {
+		slices.Reverse(comments)
+	}
+	return comments, nil
+}
+
+func (r *commentRepository) CountByBlogID(ctx context.Context, blogID int64) (int64, error) {
+	var total int64
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM comment WHERE blog_id = ?", blogID).Scan(&total)
+	return total, err
+}
+
+// ListRootsByBlogID pages through top-level comments only
+func (r *commentRepository) ListRootsByBlogID(ctx context.Context, blogID int64, limit, offset int) ([]*model.Comment, error) {
+	query := "SELECT " + commentColumns + " " +
+		"FROM comment " +
+		"WHERE blog_id = ? AND parent_id IS NULL " +
+		"ORDER BY id DESC " +
+		"LIMIT ? OFFSET ?"
+
+	rows, err := r.db.QueryContext(ctx, query, blogID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanComments(rows)
+}
+
+func (r *commentRepository) CountRootsByBlogID(ctx context.Context, blogID int64) (int64, error) {
+	var total int64
+	query := "SELECT COUNT(*) FROM comment WHERE blog_id = ? AND parent_id IS NULL"
+	err := r.db.QueryRowContext(ctx, query, blogID).Scan(&total)
+	return total, err
+}
+
+// ListReplies returns all replies below the given comments, down to maxDepth
+// levels, oldest first.
+func (r *commentRepository) ListReplies(ctx context.Context, rootIDs []int64, maxDepth int) ([]*model.Comment, error) {
+	if len(rootIDs) == 0 || maxDepth < 1 {
+		return nil, nil
+	}
+
+	args := make([]any, 0, len(rootIDs)+1)
+	for _, id := range rootIDs {
+		args = append(args, id)
+	}
+	args = append(args, maxDepth)
+
+	query := "WITH RECURSIVE thread AS (" +
+		"SELECT " + commentColumns + ", 1 AS depth " +
+		"FROM comment " +
+		"WHERE parent_id IN (" + repeatPlaceholders("?", len(rootIDs)) + ") " +
+		"UNION ALL " +
+		"SELECT c.id, c.user_id, c.blog_id, c.parent_id, c.content, c.version, t.depth + 1 " +
+		"FROM comment c " +
+		"JOIN thread t ON c.parent_id = t.id " +
+		"WHERE t.depth < ?" +
+		") " +
+		"SELECT " + commentColumns + " FROM thread ORDER BY id"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanComments(rows)
+}
+
+// Depth returns how many ancestors a comment has; top-level comments are 0
+func (r *commentRepository) Depth(ctx context.Context, id int64) (int, error) {
+	query := "WITH RECURSIVE ancestors AS (" +
+		"SELECT id, parent_id, 0 AS depth FROM comment WHERE id = ? " +
+		"UNION ALL " +
+		"SELECT c.id, c.parent_id, a.depth + 1 " +
+		"FROM comment c " +
+		"JOIN ancestors a ON c.id = a.parent_id" +
+		") " +
+		"SELECT MAX(depth) FROM ancestors"
+
+	var depth sql.NullInt64
+	if err := r.db.QueryRowContext(ctx, query, id).Scan(&depth); err != nil {
+		return 0, err
+	}
+	if !depth.Valid {
+		return 0, sql.ErrNoRows
+	}
+	return int(depth.Int64), nil
+}
+
+// ListForExport returns all comments written by a user, on any blog
+func (r *commentRepository) ListForExport(ctx context.Context, userID int64) ([]*model.ExportedComment, error) {
+	query := "SELECT " + commentColumns + ", created_at FROM comment WHERE user_id = ? ORDER BY id"
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
-	var comments []*model.Comment
+	comments := []*model.ExportedComment{}
 	for rows.Next() {
-		c := &model.Comment{}
-		if err := rows.Scan(&c.ID, &c.UserID, &c.BlogID, &c.Content); err != nil {
+		c := &model.ExportedComment{}
+		if err := rows.Scan(&c.ID, &c.UserID, &c.BlogID, &c.ParentID, &c.Content, &c.Version, &c.CreatedAt); err != nil {
 			return nil, err
 		}
 		comments = append(comments, c)
 	}
-	return comments, nil
+	return comments, rows.Err()
 }
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+)
+
+// ErrVersionConflict is returned by conditional writes when the row exists
+// but its version no longer matches the one the caller read.
+var ErrVersionConflict = errors.New("version conflict")
+
+// ErrDuplicate is returned by inserts that run into a unique key, typically
+// because a concurrent request inserted the same row first
+var ErrDuplicate = errors.New("duplicate entry")
+
+// mysqlDuplicateEntry is MySQL's ER_DUP_ENTRY
+const mysqlDuplicateEntry = 1062
+
+// duplicateError turns a unique key violation into ErrDuplicate
+func duplicateError(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+		return ErrDuplicate
+	}
+	return err
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// checkVersionedWrite tells apart the two reasons a conditional write can
+// touch no rows: the row is gone (sql.ErrNoRows) or its version moved on
+// (ErrVersionConflict). existsQuery must select a single row by id.
+func checkVersionedWrite(ctx context.Context, q queryer, res sql.Result, existsQuery string, id int64) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	var exists int
+	if err := q.QueryRowContext(ctx, existsQuery, id).Scan(&exists); err != nil {
+		return err
+	}
+	return ErrVersionConflict
+}
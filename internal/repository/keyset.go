@@ -0,0 +1,21 @@
+package repository
+
+import "maxwellzp/blog-api/internal/model"
+
+// keysetClause returns the id condition (with a leading AND) and the scan
+// order for a keyset page over a table listed newest first. Backward pages
+// are read oldest first so LIMIT keeps the rows closest to the cursor; the
+// caller reverses them afterwards.
+func keysetClause(ks model.Keyset) (string, string, []any) {
+	order := "DESC"
+	if ks.Backward {
+		order = "ASC"
+	}
+	if ks.ID == 0 {
+		return "", order, nil
+	}
+	if ks.Backward {
+		return " AND id > ?", order, []any{ks.ID}
+	}
+	return " AND id < ?", order, []any{ks.ID}
+}
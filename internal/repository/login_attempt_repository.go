@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"maxwellzp/blog-api/internal/model"
+	"time"
+)
+
+type LoginAttemptRepository interface {
+	FindByEmail(ctx context.Context, email string) (*model.LoginAttempt, error)
+	RecordFailure(ctx context.Context, email string, now time.Time, window time.Duration) (int, error)
+	Lock(ctx context.Context, email string, until time.Time) error
+	Reset(ctx context.Context, email string) error
+	PurgeStale(ctx context.Context, now time.Time, window time.Duration) (int64, error)
+}
+
+type loginAttemptRepository struct {
+	db *sql.DB
+}
+
+func NewLoginAttemptRepository(db *sql.DB) LoginAttemptRepository {
+	return &loginAttemptRepository{db: db}
+}
+
+func (r *loginAttemptRepository) FindByEmail(ctx context.Context, email string) (*model.LoginAttempt, error) {
+	query := "SELECT email, failed_count, last_failed_at, locked_until FROM login_attempt WHERE email = ?"
+	row := r.db.QueryRowContext(ctx, query, email)
+
+	attempt := &model.LoginAttempt{}
+	if err := row.Scan(&attempt.Email, &attempt.FailedCount, &attempt.LastFailedAt, &attempt.LockedUntil); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return attempt, nil
+}
+
+// RecordFailure counts a failed login and returns the number of failures in
+// a row. Failures older than window are forgotten and the count starts over.
+func (r *loginAttemptRepository) RecordFailure(ctx context.Context, email string, now time.Time, window time.Duration) (int, error) {
+	query := "INSERT INTO login_attempt (email, failed_count, last_failed_at) VALUES (?, LAST_INSERT_ID(1), ?) " +
+		"ON DUPLICATE KEY UPDATE " +
+		"failed_count = LAST_INSERT_ID(IF(last_failed_at < ?, 1, failed_count + 1)), " +
+		"last_failed_at = VALUES(last_failed_at)"
+
+	res, err := r.db.ExecContext(ctx, query, email, now, now.Add(-window))
+	if err != nil {
+		return 0, err
+	}
+	count, err := res.LastInsertId()
+	return int(count), err
+}
+
+func (r *loginAttemptRepository) Lock(ctx context.Context, email string, until time.Time) error {
+	query := "UPDATE login_attempt SET locked_until = ? WHERE email = ?"
+
+	_, err := r.db.ExecContext(ctx, query, until, email)
+	return err
+}
+
+// Reset forgets all failures, e.g. after a successful login
+func (r *loginAttemptRepository) Reset(ctx context.Context, email string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM login_attempt WHERE email = ?", email)
+	return err
+}
+
+// PurgeStale deletes the rows RecordFailure would start over anyway: no
+// failure within window and no lock still running. Most belong to emails
+// without an account, which are never Reset by a successful login.
+func (r *loginAttemptRepository) PurgeStale(ctx context.Context, now time.Time, window time.Duration) (int64, error) {
+	query := "DELETE FROM login_attempt WHERE last_failed_at < ? AND (locked_until IS NULL OR locked_until < ?)"
+
+	res, err := r.db.ExecContext(ctx, query, now.Add(-window), now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"maxwellzp/blog-api/internal/model"
+	"time"
+)
+
+type PasswordResetRepository interface {
+	Create(ctx context.Context, token *model.PasswordResetToken) error
+	FindByHash(ctx context.Context, hash string) (*model.PasswordResetToken, error)
+	MarkUsed(ctx context.Context, id int64) (bool, error)
+	InvalidateForUser(ctx context.Context, userID int64) error
+}
+
+type passwordResetRepository struct {
+	db *sql.DB
+}
+
+func NewPasswordResetRepository(db *sql.DB) PasswordResetRepository {
+	return &passwordResetRepository{db: db}
+}
+
+func (r *passwordResetRepository) Create(ctx context.Context, token *model.PasswordResetToken) error {
+	query := "INSERT INTO password_reset_token (user_id, token_hash, expires_at) VALUES (?, ?, ?)"
+
+	res, err := r.db.ExecContext(ctx, query, token.UserID, token.TokenHash, token.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	token.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *passwordResetRepository) FindByHash(ctx context.Context, hash string) (*model.PasswordResetToken, error) {
+	query := "SELECT id, user_id, token_hash, expires_at, used_at FROM password_reset_token WHERE token_hash = ?"
+	row := r.db.QueryRowContext(ctx, query, hash)
+
+	token := &model.PasswordResetToken{}
+	var usedAt sql.NullTime
+	if err := row.Scan(&token.ID, &token.UserID, &token.TokenHash, &token.ExpiresAt, &usedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	return token, nil
+}
+
+// MarkUsed consumes a token. It reports false when the token had already
+// been used, so two concurrent resets cannot both succeed.
+func (r *passwordResetRepository) MarkUsed(ctx context.Context, id int64) (bool, error) {
+	query := "UPDATE password_reset_token SET used_at = ? WHERE id = ? AND used_at IS NULL"
+
+	res, err := r.db.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// InvalidateForUser consumes every outstanding token of a user
+func (r *passwordResetRepository) InvalidateForUser(ctx context.Context, userID int64) error {
+	query := "UPDATE password_reset_token SET used_at = ? WHERE user_id = ? AND used_at IS NULL"
+
+	_, err := r.db.ExecContext(ctx, query, time.Now(), userID)
+	return err
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"maxwellzp/blog-api/internal/model"
+	"strings"
+	"time"
+)
+
+type PersonalAccessTokenRepository interface {
+	Create(ctx context.Context, token *model.PersonalAccessToken) error
+	FindByHash(ctx context.Context, hash string) (*model.PersonalAccessToken, error)
+	ListByUserID(ctx context.Context, userID int64) ([]*model.PersonalAccessToken, error)
+	Revoke(ctx context.Context, id, userID int64) (bool, error)
+	RevokeAllForUser(ctx context.Context, userID int64) error
+	TouchLastUsed(ctx context.Context, id int64, at time.Time) error
+}
+
+const personalAccessTokenColumns = "id, user_id, name, token_prefix, token_hash, scopes, expires_at, last_used_at, revoked_at, created_at"
+
+type personalAccessTokenRepository struct {
+	db *sql.DB
+}
+
+func NewPersonalAccessTokenRepository(db *sql.DB) PersonalAccessTokenRepository {
+	return &personalAccessTokenRepository{db: db}
+}
+
+func scanPersonalAccessToken(row rowScanner) (*model.PersonalAccessToken, error) {
+	t := &model.PersonalAccessToken{}
+	var scopes string
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.TokenHash, &scopes,
+		&t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range strings.Split(scopes, ",") {
+		t.Scopes = append(t.Scopes, model.Scope(scope))
+	}
+	return t, nil
+}
+
+func (r *personalAccessTokenRepository) Create(ctx context.Context, token *model.PersonalAccessToken) error {
+	scopes := make([]string, len(token.Scopes))
+	for i, scope := range token.Scopes {
+		scopes[i] = string(scope)
+	}
+	query := "INSERT INTO personal_access_token (user_id, name, token_prefix, token_hash, scopes, expires_at) " +
+		"VALUES (?, ?, ?, ?, ?, ?)"
+
+	res, err := r.db.ExecContext(ctx, query, token.UserID, token.Name, token.Prefix, token.TokenHash,
+		strings.Join(scopes, ","), token.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	token.ID, err = res.LastInsertId()
+	token.CreatedAt = time.Now()
+	return err
+}
+
+func (r *personalAccessTokenRepository) FindByHash(ctx context.Context, hash string) (*model.PersonalAccessToken, error) {
+	query := "SELECT " + personalAccessTokenColumns + " FROM personal_access_token WHERE token_hash = ?"
+
+	token, err := scanPersonalAccessToken(r.db.QueryRowContext(ctx, query, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return token, err
+}
+
+// ListByUserID returns the tokens that have not been revoked, newest first
+func (r *personalAccessTokenRepository) ListByUserID(ctx context.Context, userID int64) ([]*model.PersonalAccessToken, error) {
+	query := "SELECT " + personalAccessTokenColumns + " " +
+		"FROM personal_access_token " +
+		"WHERE user_id = ? AND revoked_at IS NULL " +
+		"ORDER BY id DESC"
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*model.PersonalAccessToken{}
+	for rows.Next() {
+		token, err := scanPersonalAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// Revoke reports false when the user has no such active token
+func (r *personalAccessTokenRepository) Revoke(ctx context.Context, id, userID int64) (bool, error) {
+	query := "UPDATE personal_access_token SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL"
+
+	res, err := r.db.ExecContext(ctx, query, time.Now(), id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (r *personalAccessTokenRepository) RevokeAllForUser(ctx context.Context, userID int64) error {
+	query := "UPDATE personal_access_token SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL"
+
+	_, err := r.db.ExecContext(ctx, query, time.Now(), userID)
+	return err
+}
+
+func (r *personalAccessTokenRepository) TouchLastUsed(ctx context.Context, id int64, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE personal_access_token SET last_used_at = ? WHERE id = ?", at, id)
+	return err
+}
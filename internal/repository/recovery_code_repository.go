@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type RecoveryCodeRepository interface {
+	Replace(ctx context.Context, userID int64, codeHashes []string) error
+	Use(ctx context.Context, userID int64, codeHash string) (bool, error)
+	CountUnused(ctx context.Context, userID int64) (int, error)
+}
+
+type recoveryCodeRepository struct {
+	db *sql.DB
+}
+
+func NewRecoveryCodeRepository(db *sql.DB) RecoveryCodeRepository {
+	return &recoveryCodeRepository{db: db}
+}
+
+// Replace drops all codes of a user and stores the new ones. An empty list
+// just removes the codes.
+func (r *recoveryCodeRepository) Replace(ctx context.Context, userID int64, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_code WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+
+	if len(codeHashes) > 0 {
+		args := make([]any, 0, len(codeHashes)*2)
+		for _, hash := range codeHashes {
+			args = append(args, userID, hash)
+		}
+		query := "INSERT INTO recovery_code (user_id, code_hash) VALUES " + repeatPlaceholders("(?, ?)", len(codeHashes))
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Use consumes a code. It reports false when the code does not exist or was
+// already used.
+func (r *recoveryCodeRepository) Use(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	query := "UPDATE recovery_code SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL"
+
+	res, err := r.db.ExecContext(ctx, query, time.Now(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (r *recoveryCodeRepository) CountUnused(ctx context.Context, userID int64) (int, error) {
+	var count int
+	query := "SELECT COUNT(*) FROM recovery_code WHERE user_id = ? AND used_at IS NULL"
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
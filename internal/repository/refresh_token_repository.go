@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"maxwellzp/blog-api/internal/model"
+	"time"
+)
+
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *model.RefreshToken) error
+	FindByHash(ctx context.Context, hash string) (*model.RefreshToken, error)
+	Revoke(ctx context.Context, id int64) (bool, error)
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeAllForUser(ctx context.Context, userID int64) error
+}
+
+type refreshTokenRepository struct {
+	db *sql.DB
+}
+
+func NewRefreshTokenRepository(db *sql.DB) RefreshTokenRepository {
+	return &refreshTokenRepository{db: db}
+}
+
+func (r *refreshTokenRepository) Create(ctx context.Context, token *model.RefreshToken) error {
+	query := "INSERT INTO refresh_token (user_id, family_id, token_hash, expires_at) VALUES (?, ?, ?, ?)"
+
+	res, err := r.db.ExecContext(ctx, query, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	token.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *refreshTokenRepository) FindByHash(ctx context.Context, hash string) (*model.RefreshToken, error) {
+	query := "SELECT id, user_id, family_id, token_hash, expires_at, revoked_at FROM refresh_token WHERE token_hash = ?"
+	row := r.db.QueryRowContext(ctx, query, hash)
+
+	token := &model.RefreshToken{}
+	var revokedAt sql.NullTime
+	if err := row.Scan(&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash, &token.ExpiresAt, &revokedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return token, nil
+}
+
+// Revoke marks a single token as used. It reports false when the token had
+// already been revoked, which lets the caller detect a concurrent reuse.
+func (r *refreshTokenRepository) Revoke(ctx context.Context, id int64) (bool, error) {
+	query := "UPDATE refresh_token SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL"
+
+	res, err := r.db.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (r *refreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	query := "UPDATE refresh_token SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL"
+
+	_, err := r.db.ExecContext(ctx, query, time.Now(), familyID)
+	return err
+}
+
+func (r *refreshTokenRepository) RevokeAllForUser(ctx context.Context, userID int64) error {
+	query := "UPDATE refresh_token SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL"
+
+	_, err := r.db.ExecContext(ctx, query, time.Now(), userID)
+	return err
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"maxwellzp/blog-api/internal/model"
+)
+
+// SearchRepository is implemented per search engine; callers only rely on
+// results being ordered by descending relevance.
+type SearchRepository interface {
+	Search(ctx context.Context, query string, limit, offset int) ([]*model.SearchResult, error)
+}
+
+type mysqlSearchRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLSearchRepository uses the FULLTEXT indexes on blog and comment
+func NewMySQLSearchRepository(db *sql.DB) SearchRepository {
+	return &mysqlSearchRepository{db: db}
+}
+
+func (r *mysqlSearchRepository) Search(ctx context.Context, query string, limit, offset int) ([]*model.SearchResult, error) {
+	sqlQuery := "SELECT type, id, blog_id, title, content, score FROM (" +
+		"SELECT 'blog' AS type, b.id, b.id AS blog_id, b.title, b.content, " +
+		"MATCH (b.title, b.content) AGAINST (? IN NATURAL LANGUAGE MODE) AS score " +
+		"FROM blog b " +
+		"WHERE MATCH (b.title, b.content) AGAINST (? IN NATURAL LANGUAGE MODE) " +
+		"AND b.deleted_at IS NULL AND b.status = 'published' " +
+		"UNION ALL " +
+		"SELECT 'comment' AS type, c.id, c.blog_id, b.title, c.content, " +
+		"MATCH (c.content) AGAINST (? IN NATURAL LANGUAGE MODE) AS score " +
+		"FROM comment c " +
+		"JOIN blog b ON b.id = c.blog_id " +
+		"WHERE MATCH (c.content) AGAINST (? IN NATURAL LANGUAGE MODE) " +
+		"AND b.deleted_at IS NULL AND b.status = 'published'" +
+		") results " +
+		"ORDER BY score DESC, id DESC " +
+		"LIMIT ? OFFSET ?"
+
+	rows, err := r.db.QueryContext(ctx, sqlQuery, query, query, query, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]*model.SearchResult, 0, limit)
+	for rows.Next() {
+		res := &model.SearchResult{}
+		if err := rows.Scan(&res.Type, &res.ID, &res.BlogID, &res.BlogTitle, &res.Content, &res.Score); err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"maxwellzp/blog-api/internal/model"
+	"time"
+)
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *model.Session) error
+	FindByID(ctx context.Context, id int64) (*model.Session, error)
+	FindByFamilyID(ctx context.Context, familyID string) (*model.Session, error)
+	ListActiveByUserID(ctx context.Context, userID int64, seenSince time.Time) ([]*model.Session, error)
+	TouchLastSeen(ctx context.Context, id int64, at time.Time) error
+	Revoke(ctx context.Context, id, userID int64) (bool, error)
+	RevokeAllForUser(ctx context.Context, userID int64) error
+}
+
+const sessionColumns = "id, user_id, family_id, user_agent, ip, created_at, last_seen_at, revoked_at"
+
+type sessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+// scanSession returns nil, nil when the row does not exist
+func scanSession(row rowScanner) (*model.Session, error) {
+	session := &model.Session{}
+	err := row.Scan(&session.ID, &session.UserID, &session.FamilyID, &session.UserAgent, &session.IP,
+		&session.CreatedAt, &session.LastSeenAt, &session.RevokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+func (r *sessionRepository) Create(ctx context.Context, session *model.Session) error {
+	query := "INSERT INTO user_session (user_id, family_id, user_agent, ip, last_seen_at) VALUES (?, ?, ?, ?, ?)"
+
+	res, err := r.db.ExecContext(ctx, query,
+		session.UserID, session.FamilyID, session.UserAgent, session.IP, session.LastSeenAt)
+	if err != nil {
+		return err
+	}
+	session.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *sessionRepository) FindByID(ctx context.Context, id int64) (*model.Session, error) {
+	query := "SELECT " + sessionColumns + " FROM user_session WHERE id = ?"
+
+	return scanSession(r.db.QueryRowContext(ctx, query, id))
+}
+
+func (r *sessionRepository) FindByFamilyID(ctx context.Context, familyID string) (*model.Session, error) {
+	query := "SELECT " + sessionColumns + " FROM user_session WHERE family_id = ?"
+
+	return scanSession(r.db.QueryRowContext(ctx, query, familyID))
+}
+
+// ListActiveByUserID returns the sessions not revoked and seen since the
+// given time, most recently seen first.
+func (r *sessionRepository) ListActiveByUserID(ctx context.Context, userID int64, seenSince time.Time) ([]*model.Session, error) {
+	query := "SELECT " + sessionColumns + " FROM user_session " +
+		"WHERE user_id = ? AND revoked_at IS NULL AND last_seen_at >= ? ORDER BY last_seen_at DESC, id DESC"
+
+	rows, err := r.db.QueryContext(ctx, query, userID, seenSince)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*model.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *sessionRepository) TouchLastSeen(ctx context.Context, id int64, at time.Time) error {
+	query := "UPDATE user_session SET last_seen_at = ? WHERE id = ?"
+
+	_, err := r.db.ExecContext(ctx, query, at, id)
+	return err
+}
+
+// Revoke reports false when the user has no such active session
+func (r *sessionRepository) Revoke(ctx context.Context, id, userID int64) (bool, error) {
+	query := "UPDATE user_session SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL"
+
+	res, err := r.db.ExecContext(ctx, query, time.Now(), id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (r *sessionRepository) RevokeAllForUser(ctx context.Context, userID int64) error {
+	query := "UPDATE user_session SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL"
+
+	_, err := r.db.ExecContext(ctx, query, time.Now(), userID)
+	return err
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"maxwellzp/blog-api/internal/model"
+	"strings"
+)
+
+type TagRepository interface {
+	ListByBlogIDs(ctx context.Context, blogIDs []int64) (map[int64][]string, error)
+	ListWithCounts(ctx context.Context) ([]*model.Tag, error)
+}
+
+type tagRepository struct {
+	db *sql.DB
+}
+
+func NewTagRepository(db *sql.DB) TagRepository {
+	return &tagRepository{db: db}
+}
+
+// setBlogTags replaces the tags of a blog inside the caller's transaction,
+// creating missing tags on the way
+func setBlogTags(ctx context.Context, tx *sql.Tx, blogID int64, names []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM blog_tag WHERE blog_id = ?", blogID); err != nil {
+		return err
+	}
+
+	if len(names) > 0 {
+		args := make([]any, len(names))
+		for i, name := range names {
+			args[i] = name
+		}
+
+		insertTags := "INSERT IGNORE INTO tag (name) VALUES " + repeatPlaceholders("(?)", len(names))
+		if _, err := tx.ExecContext(ctx, insertTags, args...); err != nil {
+			return err
+		}
+
+		linkTags := "INSERT INTO blog_tag (blog_id, tag_id) " +
+			"SELECT ?, id FROM tag WHERE name IN (" + repeatPlaceholders("?", len(names)) + ")"
+		if _, err := tx.ExecContext(ctx, linkTags, append([]any{blogID}, args...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *tagRepository) ListByBlogIDs(ctx context.Context, blogIDs []int64) (map[int64][]string, error) {
+	tags := make(map[int64][]string, len(blogIDs))
+	if len(blogIDs) == 0 {
+		return tags, nil
+	}
+
+	args := make([]any, len(blogIDs))
+	for i, id := range blogIDs {
+		args[i] = id
+	}
+	query := "SELECT bt.blog_id, t.name " +
+		"FROM blog_tag bt " +
+		"JOIN tag t ON t.id = bt.tag_id " +
+		"WHERE bt.blog_id IN (" + repeatPlaceholders("?", len(blogIDs)) + ") " +
+		"ORDER BY t.name"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var blogID int64
+		var name string
+		if err := rows.Scan(&blogID, &name); err != nil {
+			return nil, err
+		}
+		tags[blogID] = append(tags[blogID], name)
+	}
+	return tags, rows.Err()
+}
+
+// ListWithCounts only counts published blogs, so tags used solely by drafts
+// are left out.
+func (r *tagRepository) ListWithCounts(ctx context.Context) ([]*model.Tag, error) {
+	query := "SELECT t.name, COUNT(b.id) AS post_count " +
+		"FROM tag t " +
+		"JOIN blog_tag bt ON bt.tag_id = t.id " +
+		"JOIN blog b ON b.id = bt.blog_id AND b.deleted_at IS NULL AND b.status = 'published' " +
+		"GROUP BY t.id, t.name " +
+		"ORDER BY post_count DESC, t.name"
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]*model.Tag, 0)
+	for rows.Next() {
+		tag := &model.Tag{}
+		if err := rows.Scan(&tag.Name, &tag.PostCount); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// repeatPlaceholders joins n copies of a placeholder group with commas
+func repeatPlaceholders(group string, n int) string {
+	return strings.TrimSuffix(strings.Repeat(group+", ", n), ", ")
+}
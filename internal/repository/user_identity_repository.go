@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"maxwellzp/blog-api/internal/model"
+)
+
+type UserIdentityRepository interface {
+	Create(ctx context.Context, identity *model.UserIdentity) error
+	CreateWithUser(ctx context.Context, user *model.User, identity *model.UserIdentity) error
+	FindBySubject(ctx context.Context, provider, subject string) (*model.UserIdentity, error)
+}
+
+type userIdentityRepository struct {
+	db *sql.DB
+}
+
+func NewUserIdentityRepository(db *sql.DB) UserIdentityRepository {
+	return &userIdentityRepository{db: db}
+}
+
+// Create links an identity to an existing user. It returns ErrDuplicate when
+// the identity is already linked.
+func (r *userIdentityRepository) Create(ctx context.Context, identity *model.UserIdentity) error {
+	return insertIdentity(ctx, r.db, identity)
+}
+
+// CreateWithUser creates a user together with the identity they logged in
+// with, so that a failed login leaves no account behind. The user's email
+// verification and profile are written as well. It returns ErrDuplicate when
+// the email or the identity is taken.
+func (r *userIdentityRepository) CreateWithUser(ctx context.Context, user *model.User, identity *model.UserIdentity) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO user (username, email, password, role, display_name, avatar_url, email_verified_at) " +
+		"VALUES (?, ?, ?, ?, ?, ?, ?)"
+	res, err := tx.ExecContext(ctx, query, user.Username, user.Email, user.Password, user.Role,
+		user.DisplayName, user.AvatarURL, user.EmailVerifiedAt)
+	if err != nil {
+		return duplicateError(err)
+	}
+	userID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	identity.UserID = userID
+	if err := insertIdentity(ctx, tx, identity); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	user.ID = userID
+	return nil
+}
+
+func insertIdentity(ctx context.Context, db execer, identity *model.UserIdentity) error {
+	query := "INSERT INTO user_identity (user_id, provider, subject, email) VALUES (?, ?, ?, ?)"
+
+	res, err := db.ExecContext(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email)
+	if err != nil {
+		return duplicateError(err)
+	}
+	identity.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *userIdentityRepository) FindBySubject(ctx context.Context, provider, subject string) (*model.UserIdentity, error) {
+	query := "SELECT id, user_id, provider, subject, email, created_at FROM user_identity WHERE provider = ? AND subject = ?"
+
+	identity := &model.UserIdentity{}
+	err := r.db.QueryRowContext(ctx, query, provider, subject).
+		Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return identity, nil
+}
@@ -5,13 +5,32 @@ import (
 	"database/sql"
 	"errors"
 	"maxwellzp/blog-api/internal/model"
+	"time"
 )
 
 type UserRepository interface {
 	Create(ctx context.Context, user *model.User) error
 	FindByEmail(ctx context.Context, email string) (*model.User, error)
+	FindByID(ctx context.Context, id int64) (*model.User, error)
+	UpdateRole(ctx context.Context, id int64, role model.Role) error
+	UpdateProfile(ctx context.Context, user *model.User) error
+	UpdatePassword(ctx context.Context, id int64, passwordHash string) error
+	MarkEmailVerified(ctx context.Context, id int64, email string, at time.Time) (bool, error)
+	SetTOTPSecret(ctx context.Context, id int64, secret string) error
+	EnableTOTP(ctx context.Context, id int64, at time.Time) error
+	DisableTOTP(ctx context.Context, id int64) error
+	UseTOTPStep(ctx context.Context, id int64, step int64) (bool, error)
+	ListSummariesByIDs(ctx context.Context, ids []int64) (map[int64]*model.AuthorSummary, error)
+	ScheduleDeletion(ctx context.Context, id int64, at time.Time) error
+	CancelDeletion(ctx context.Context, id int64) error
+	ListDueForDeletion(ctx context.Context, now time.Time, limit int) ([]int64, error)
+	Delete(ctx context.Context, id int64) error
+	Anonymize(ctx context.Context, id int64, at time.Time) error
 }
 
+const userColumns = "id, username, email, password, role, display_name, bio, avatar_url, created_at, email_verified_at, " +
+	"totp_secret, totp_enabled_at, totp_last_step, deletion_scheduled_at, deleted_at"
+
 type userRepository struct {
 	db *sql.DB
 }
@@ -20,10 +39,25 @@ func NewUserRepository(db *sql.DB) UserRepository {
 	return &userRepository{db: db}
 }
 
+// scanUser returns nil, nil when the row does not exist
+func scanUser(row rowScanner) (*model.User, error) {
+	user := &model.User{}
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.Role,
+		&user.DisplayName, &user.Bio, &user.AvatarURL, &user.CreatedAt, &user.EmailVerifiedAt,
+		&user.TOTPSecret, &user.TOTPEnabledAt, &user.TOTPLastStep, &user.DeletionScheduledAt, &user.DeletedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
 func (r *userRepository) Create(ctx context.Context, user *model.User) error {
-	query := `INSERT INTO user (username, email, password) VALUES (?, ?, ?)`
+	query := `INSERT INTO user (username, email, password, role) VALUES (?, ?, ?, ?)`
 
-	result, err := r.db.ExecContext(ctx, query, user.Username, user.Email, user.Password)
+	result, err := r.db.ExecContext(ctx, query, user.Username, user.Email, user.Password, user.Role)
 	if err != nil {
 		return err
 	}
@@ -32,16 +66,218 @@ func (r *userRepository) Create(ctx context.Context, user *model.User) error {
 }
 
 func (r *userRepository) FindByEmail(ctx context.Context, email string) (*model.User, error) {
-	query := `SELECT id, username, email, password FROM user WHERE email = ?`
-	row := r.db.QueryRowContext(ctx, query, email)
+	query := `SELECT ` + userColumns + ` FROM user WHERE email = ?`
 
-	user := &model.User{}
-	if err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Password); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+	return scanUser(r.db.QueryRowContext(ctx, query, email))
+}
+
+func (r *userRepository) FindByID(ctx context.Context, id int64) (*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM user WHERE id = ?`
+
+	return scanUser(r.db.QueryRowContext(ctx, query, id))
+}
+
+func (r *userRepository) UpdateRole(ctx context.Context, id int64, role model.Role) error {
+	query := `UPDATE user SET role = ? WHERE id = ?`
+
+	_, err := r.db.ExecContext(ctx, query, role, id)
+	return err
+}
+
+func (r *userRepository) UpdateProfile(ctx context.Context, user *model.User) error {
+	query := `UPDATE user SET display_name = ?, bio = ?, avatar_url = ? WHERE id = ?`
+
+	_, err := r.db.ExecContext(ctx, query, user.DisplayName, user.Bio, user.AvatarURL, user.ID)
+	return err
+}
+
+func (r *userRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	query := `UPDATE user SET password = ? WHERE id = ?`
+
+	_, err := r.db.ExecContext(ctx, query, passwordHash, id)
+	return err
+}
+
+// MarkEmailVerified only succeeds while the user still has the verified
+// address, so a link sent to a previous address cannot verify a new one. It
+// reports false when nothing was updated, including when already verified.
+func (r *userRepository) MarkEmailVerified(ctx context.Context, id int64, email string, at time.Time) (bool, error) {
+	query := `UPDATE user SET email_verified_at = ? WHERE id = ? AND email = ? AND email_verified_at IS NULL`
+
+	res, err := r.db.ExecContext(ctx, query, at, id, email)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// SetTOTPSecret starts a new enrollment. 2FA stays off until EnableTOTP.
+func (r *userRepository) SetTOTPSecret(ctx context.Context, id int64, secret string) error {
+	query := `UPDATE user SET totp_secret = ?, totp_enabled_at = NULL, totp_last_step = 0 WHERE id = ?`
+
+	_, err := r.db.ExecContext(ctx, query, secret, id)
+	return err
+}
+
+func (r *userRepository) EnableTOTP(ctx context.Context, id int64, at time.Time) error {
+	query := `UPDATE user SET totp_enabled_at = ? WHERE id = ?`
+
+	_, err := r.db.ExecContext(ctx, query, at, id)
+	return err
+}
+
+func (r *userRepository) DisableTOTP(ctx context.Context, id int64) error {
+	query := `UPDATE user SET totp_secret = '', totp_enabled_at = NULL, totp_last_step = 0 WHERE id = ?`
+
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// UseTOTPStep records that a code for step was accepted. It reports false
+// when that step or a later one was already used, i.e. the code is a replay.
+func (r *userRepository) UseTOTPStep(ctx context.Context, id int64, step int64) (bool, error) {
+	query := `UPDATE user SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`
+
+	res, err := r.db.ExecContext(ctx, query, step, id, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ListSummariesByIDs loads the author summaries for a whole listing at once
+func (r *userRepository) ListSummariesByIDs(ctx context.Context, ids []int64) (map[int64]*model.AuthorSummary, error) {
+	authors := make(map[int64]*model.AuthorSummary, len(ids))
+	if len(ids) == 0 {
+		return authors, nil
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	query := `SELECT id, username, avatar_url FROM user WHERE id IN (` + repeatPlaceholders("?", len(ids)) + `)`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a := &model.AuthorSummary{}
+		if err := rows.Scan(&a.ID, &a.Username, &a.AvatarURL); err != nil {
+			return nil, err
 		}
+		authors[a.ID] = a
+	}
+	return authors, rows.Err()
+}
+
+func (r *userRepository) ScheduleDeletion(ctx context.Context, id int64, at time.Time) error {
+	query := `UPDATE user SET deletion_scheduled_at = ? WHERE id = ? AND deleted_at IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query, at, id)
+	return err
+}
+
+func (r *userRepository) CancelDeletion(ctx context.Context, id int64) error {
+	query := `UPDATE user SET deletion_scheduled_at = NULL WHERE id = ? AND deleted_at IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func (r *userRepository) ListDueForDeletion(ctx context.Context, now time.Time, limit int) ([]int64, error) {
+	query := `SELECT id FROM user WHERE deletion_scheduled_at <= ? ORDER BY deletion_scheduled_at LIMIT ?`
+
+	rows, err := r.db.QueryContext(ctx, query, now, limit)
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return user, nil
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Delete removes a user scheduled for deletion together with everything
+// that references it through ON DELETE CASCADE, including comments on other
+// users' blogs; replies to those comments become top-level comments.
+// Revisions of other users' blogs are kept without an author. Users who
+// cancelled in the meantime are left alone.
+func (r *userRepository) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM user WHERE id = ? AND deletion_scheduled_at IS NOT NULL`
+
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// anonymizeQueries remove the user's own content and credentials. Comments
+// on other users' blogs and blog revisions stay, attributed to the
+// anonymized user.
+var anonymizeQueries = []string{
+	`DELETE FROM blog WHERE user_id = ?`,
+	`DELETE FROM refresh_token WHERE user_id = ?`,
+	`DELETE FROM user_session WHERE user_id = ?`,
+	`DELETE FROM personal_access_token WHERE user_id = ?`,
+	`DELETE FROM user_identity WHERE user_id = ?`,
+	`DELETE FROM recovery_code WHERE user_id = ?`,
+	`DELETE FROM password_reset_token WHERE user_id = ?`,
+}
+
+// Anonymize keeps the user row, so that the comments kept by
+// anonymizeQueries still have an author, but erases everything personal in
+// it. Like Delete, it does nothing for users who cancelled the deletion.
+func (r *userRepository) Anonymize(ctx context.Context, id int64, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking the row keeps a concurrent login from cancelling halfway
+	var email string
+	query := `SELECT email FROM user WHERE id = ? AND deletion_scheduled_at IS NOT NULL FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, id).Scan(&email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM login_attempt WHERE email = ?`, email); err != nil {
+		return err
+	}
+	for _, query := range anonymizeQueries {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return err
+		}
+	}
+
+	// The email stays unique without pointing to anyone
+	query = `UPDATE user SET username = 'deleted', email = CONCAT('deleted-', id, '@invalid'), password = '', ` +
+		`role = 'user', display_name = '', bio = '', avatar_url = '', email_verified_at = NULL, ` +
+		`totp_secret = '', totp_enabled_at = NULL, totp_last_step = 0, ` +
+		`deletion_scheduled_at = NULL, deleted_at = ? WHERE id = ?`
+	if _, err := tx.ExecContext(ctx, query, at, id); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
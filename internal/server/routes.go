@@ -7,7 +7,9 @@ import (
 	"golang.org/x/time/rate"
 	"maxwellzp/blog-api/internal/config"
 	"maxwellzp/blog-api/internal/handler"
+	"maxwellzp/blog-api/internal/jwtkeys"
 	appMiddleware "maxwellzp/blog-api/internal/middleware"
+	"maxwellzp/blog-api/internal/model"
 	"net/http"
 	"time"
 )
@@ -16,9 +18,18 @@ func registerRoutes(
 	e *echo.Echo,
 	cfg *config.Config,
 	log *zap.SugaredLogger,
+	keys *jwtkeys.KeySet,
 	auth *handler.AuthHandler,
+	oidc *handler.OIDCHandler,
+	password *handler.PasswordHandler,
+	twoFactor *handler.TwoFactorHandler,
+	token *handler.TokenHandler,
+	session *handler.SessionHandler,
+	account *handler.AccountHandler,
 	blog *handler.BlogHandler,
 	comment *handler.CommentHandler,
+	user *handler.UserHandler,
+	search *handler.SearchHandler,
 ) {
 	loginLimiter := echoMiddleware.NewRateLimiterMemoryStoreWithConfig(
 		echoMiddleware.RateLimiterMemoryStoreConfig{
@@ -27,6 +38,14 @@ func registerRoutes(
 			ExpiresIn: 15 * time.Minute,             // Sets how long the client’s token bucket state is remembered in memory (per IP by default).
 		},
 	)
+	// Password reset emails get their own bucket so that they do not eat into login attempts
+	passwordLimiter := echoMiddleware.NewRateLimiterMemoryStoreWithConfig(
+		echoMiddleware.RateLimiterMemoryStoreConfig{
+			Rate:      rate.Every(30 * time.Second),
+			Burst:     2,
+			ExpiresIn: 15 * time.Minute,
+		},
+	)
 
 	// Global middleware
 	e.Use(echoMiddleware.Recover())
@@ -53,24 +72,91 @@ func registerRoutes(
 	e.GET("/healthz", func(c echo.Context) error {
 		return c.NoContent(http.StatusOK)
 	})
+	// Lets other services verify access tokens
+	e.GET("/.well-known/jwks.json", func(c echo.Context) error {
+		c.Response().Header().Set("Cache-Control", "public, max-age=300")
+		return c.JSON(http.StatusOK, keys.JWKS())
+	})
 	e.POST("/register", auth.Register)
 	e.POST("/login", auth.Login, echoMiddleware.RateLimiter(loginLimiter))
-	e.GET("/blogs", blog.List)
-	e.GET("/blogs/:id", blog.GetByID)
-	e.GET("/blogs/:blog_id/comments", comment.ListByBlogID)
-	e.GET("/comments/:id", comment.GetByID)
+	e.POST("/login/mfa", auth.LoginMFA, echoMiddleware.RateLimiter(loginLimiter))
+	e.GET("/auth/oidc", oidc.Providers)
+	e.GET("/auth/oidc/:provider", oidc.Start)
+	e.GET("/auth/oidc/:provider/callback", oidc.Callback, echoMiddleware.RateLimiter(loginLimiter))
+	e.POST("/token/refresh", auth.Refresh)
+	e.POST("/logout", auth.Logout)
+	e.POST("/password/forgot", password.Forgot, echoMiddleware.RateLimiter(passwordLimiter))
+	e.POST("/password/reset", password.Reset, echoMiddleware.RateLimiter(passwordLimiter))
+	e.GET("/verify-email", auth.VerifyEmail)
+	// Optional auth lets authors see their own drafts on the public read routes
+	optionalAuth := appMiddleware.OptionalJWTMiddleware(keys, token.TokenService, session.SessionService, log)
+	e.GET("/blogs", blog.List, optionalAuth)
+	e.GET("/blogs/:id", blog.GetByID, optionalAuth)
+	e.GET("/tags", blog.ListTags)
+	e.GET("/search", search.Search)
+	e.GET("/blogs/:blog_id/comments", comment.ListByBlogID, optionalAuth)
+	e.GET("/comments/:id", comment.GetByID, optionalAuth)
+	e.GET("/users/:id", user.GetByID)
 
 	// --- Protected Routes ---
 	authorized := e.Group("")
-	authorized.Use(appMiddleware.JWTMiddleware(cfg.JWTSecret, log))
+	authorized.Use(appMiddleware.JWTMiddleware(keys, token.TokenService, session.SessionService, log))
+
+	// Personal access tokens can always read; writing needs the matching
+	// scope, and account management is limited to real sessions
+	blogsWrite := appMiddleware.RequireScope(model.ScopeBlogsWrite)
+	commentsWrite := appMiddleware.RequireScope(model.ScopeCommentsWrite)
+	requireSession := appMiddleware.RequireSession()
 
 	// Blogs (auth required)
-	authorized.POST("/blogs", blog.Create)
-	authorized.PUT("/blogs/:id", blog.Update)
-	authorized.DELETE("/blogs/:id", blog.Delete)
+	// Creating content can be limited to verified accounts to keep out
+	// throwaway sign-ups
+	var requireVerified []echo.MiddlewareFunc
+	if cfg.RequireVerifiedEmail {
+		requireVerified = append(requireVerified, appMiddleware.RequireVerifiedEmail())
+	}
+
+	authorized.POST("/blogs", blog.Create, append([]echo.MiddlewareFunc{blogsWrite}, requireVerified...)...)
+	authorized.PUT("/blogs/:id", blog.Update, blogsWrite)
+	authorized.DELETE("/blogs/:id", blog.Delete, blogsWrite)
+	authorized.POST("/blogs/:id/publish", blog.Publish, blogsWrite)
+	authorized.POST("/blogs/:id/unpublish", blog.Unpublish, blogsWrite)
+	authorized.POST("/blogs/:id/archive", blog.Archive, blogsWrite)
+	authorized.POST("/blogs/:id/restore", blog.Restore, blogsWrite)
+	authorized.GET("/blogs/:id/revisions", blog.ListRevisions)
+	authorized.GET("/blogs/:id/revisions/diff", blog.DiffRevisions)
+	authorized.GET("/blogs/:id/revisions/:rev", blog.GetRevision)
+	authorized.POST("/blogs/:id/revisions/:rev/restore", blog.RestoreRevision, blogsWrite)
+
+	// Current user
+	authorized.GET("/me", user.Me)
+	authorized.PATCH("/me", user.UpdateMe, requireSession)
+	authorized.POST("/me/password", password.Change, requireSession, echoMiddleware.RateLimiter(passwordLimiter))
+	authorized.POST("/me/verify-email", auth.ResendVerification, requireSession, echoMiddleware.RateLimiter(passwordLimiter))
+	authorized.POST("/me/2fa/enroll", twoFactor.Enroll, requireSession)
+	authorized.POST("/me/2fa/confirm", twoFactor.Confirm, requireSession, echoMiddleware.RateLimiter(passwordLimiter))
+	authorized.POST("/me/2fa/disable", twoFactor.Disable, requireSession, echoMiddleware.RateLimiter(passwordLimiter))
+	authorized.GET("/me/trash", blog.ListTrash)
+
+	// Personal access tokens; a token cannot be used to mint or revoke tokens
+	authorized.GET("/me/tokens", token.List, requireSession)
+	authorized.POST("/me/tokens", token.Create, requireSession)
+	authorized.DELETE("/me/tokens/:id", token.Revoke, requireSession)
+
+	// Sessions, to sign out other devices
+	authorized.GET("/me/sessions", session.List, requireSession)
+	authorized.DELETE("/me/sessions/:id", session.Revoke, requireSession)
+
+	// Data export and account deletion
+	authorized.GET("/me/export", account.Export, requireSession)
+	authorized.DELETE("/me", account.Delete, requireSession, echoMiddleware.RateLimiter(passwordLimiter))
 
 	// Comments (auth required)
-	authorized.POST("/comments", comment.Create)
-	authorized.PUT("/comments/:id", comment.Update)
-	authorized.DELETE("/comments/:id", comment.Delete)
+	authorized.POST("/comments", comment.Create, append([]echo.MiddlewareFunc{commentsWrite}, requireVerified...)...)
+	authorized.PUT("/comments/:id", comment.Update, commentsWrite)
+	authorized.DELETE("/comments/:id", comment.Delete, commentsWrite)
+
+	// Administration (admin role required)
+	requireUserManager := appMiddleware.RequirePermission(model.Role.CanManageUsers)
+	authorized.PATCH("/users/:id/role", user.UpdateRole, requireSession, requireUserManager)
 }
@@ -7,20 +7,27 @@ import (
 	"maxwellzp/blog-api/internal/config"
 	"maxwellzp/blog-api/internal/database"
 	"maxwellzp/blog-api/internal/handler"
+	"maxwellzp/blog-api/internal/jwtkeys"
+	"maxwellzp/blog-api/internal/mailer"
+	"maxwellzp/blog-api/internal/oidc"
 	"maxwellzp/blog-api/internal/repository"
 	"maxwellzp/blog-api/internal/service"
 	"maxwellzp/blog-api/internal/validation"
+	"maxwellzp/blog-api/internal/worker"
 	"net/http"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
 
 type Server struct {
-	e    *echo.Echo
-	cfg  *config.Config
-	log  *zap.SugaredLogger
-	port string
+	e       *echo.Echo
+	cfg     *config.Config
+	log     *zap.SugaredLogger
+	port    string
+	workers []worker.Worker
 }
 
 func New(cfg *config.Config, logger *zap.SugaredLogger) *Server {
@@ -33,27 +40,115 @@ func New(cfg *config.Config, logger *zap.SugaredLogger) *Server {
 	)
 	validator := validation.NewValidator()
 
+	keys := jwtkeys.NewHMAC(cfg.JWTSecret)
+	if cfg.JWTKeysDir != "" {
+		var err error
+		if keys, err = jwtkeys.Load(cfg.JWTKeysDir, cfg.JWTSigningKeyID); err != nil {
+			logger.Fatalw("loading JWT keys",
+				"error", err,
+				"dir", cfg.JWTKeysDir,
+			)
+		}
+	}
+
+	var hasher service.PasswordHasher
+	if cfg.PasswordHasher == "bcrypt" {
+		hasher = service.NewBcryptHasher(cfg.BcryptCost)
+	} else {
+		hasher = service.NewArgon2idHasher(service.Argon2Params{
+			Memory:      uint32(cfg.Argon2Memory),
+			Iterations:  uint32(cfg.Argon2Iterations),
+			Parallelism: uint8(cfg.Argon2Parallelism),
+		})
+	}
+
 	// DI
 	userRepo := repository.NewUserRepository(db)
-	authService := service.NewAuthService(userRepo, cfg.JWTSecret)
-	authHandler := handler.NewAuthHandler(authService, logger, validator)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
+	recoveryCodeRepo := repository.NewRecoveryCodeRepository(db)
+	twoFactorService := service.NewTwoFactorService(userRepo, recoveryCodeRepo, cfg.TOTPIssuer)
+	twoFactorHandler := handler.NewTwoFactorHandler(twoFactorService, logger, validator)
+
+	sessionRepo := repository.NewSessionRepository(db)
+	sessionService := service.NewSessionService(sessionRepo, refreshTokenRepo, cfg.RefreshTokenTTL, cfg.SessionCacheTTL)
+	sessionHandler := handler.NewSessionHandler(sessionService, logger)
+
+	loginAttemptRepo := repository.NewLoginAttemptRepository(db)
+	authService := service.NewAuthService(userRepo, refreshTokenRepo, loginAttemptRepo, twoFactorService,
+		sessionService, hasher, keys, cfg.JWTSecret, cfg.AccessTokenTTL, cfg.RefreshTokenTTL, cfg.MFATokenTTL, service.LockoutPolicy{
+			MaxAttempts:   cfg.LoginMaxAttempts,
+			BaseLockout:   cfg.LoginLockoutBase,
+			MaxLockout:    cfg.LoginLockoutMax,
+			FailureWindow: cfg.LoginFailureWindow,
+		})
+	identityRepo := repository.NewUserIdentityRepository(db)
+	oidcProviders := make(map[string]*oidc.Provider)
+	for _, p := range cfg.OIDCProviders {
+		oidcProviders[p.Name] = oidc.NewProvider(oidc.Config{
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  cfg.PublicURL + "/auth/oidc/" + p.Name + "/callback",
+		})
+	}
+	oidcService := service.NewOIDCService(oidcProviders, authService, userRepo, identityRepo,
+		cfg.JWTSecret, cfg.OIDCStateTTL)
+	oidcHandler := handler.NewOIDCHandler(oidcService, logger,
+		strings.HasPrefix(cfg.PublicURL, "https://"), cfg.OIDCStateTTL)
+
+	mail := mailer.New(cfg, logger)
+	verificationService := service.NewVerificationService(userRepo, mail, cfg.JWTSecret,
+		cfg.PublicURL+"/verify-email", cfg.EmailVerificationTTL)
+	authHandler := handler.NewAuthHandler(authService, verificationService, logger, validator)
+
+	passwordResetRepo := repository.NewPasswordResetRepository(db)
+	passwordService := service.NewPasswordService(userRepo, sessionService, hasher, passwordResetRepo,
+		mail, cfg.PasswordResetURL, cfg.PasswordResetTTL)
+	passwordHandler := handler.NewPasswordHandler(passwordService, logger, validator)
 
 	blogRepo := repository.NewBlogRepository(db)
-	blogService := service.NewBlogService(blogRepo)
+	tagRepo := repository.NewTagRepository(db)
+	blogRevisionRepo := repository.NewBlogRevisionRepository(db)
+	blogService := service.NewBlogService(blogRepo, tagRepo, blogRevisionRepo, userRepo)
 	blogHandler := handler.NewBlogHandler(blogService, logger, validator)
 
+	tokenRepo := repository.NewPersonalAccessTokenRepository(db)
+	tokenService := service.NewPersonalAccessTokenService(tokenRepo, userRepo)
+	tokenHandler := handler.NewTokenHandler(tokenService, logger, validator)
+
+	userService := service.NewUserService(userRepo)
+	userHandler := handler.NewUserHandler(userService, blogService, logger, validator)
+
 	commentRepo := repository.NewCommentRepository(db)
-	commentService := service.NewCommentService(commentRepo)
+	commentService := service.NewCommentService(commentRepo, blogRepo, userRepo, cfg.CommentMaxDepth)
 	commentHandler := handler.NewCommentHandler(commentService, logger, validator)
 
+	searchRepo := repository.NewMySQLSearchRepository(db)
+	searchService := service.NewSearchService(searchRepo)
+	searchHandler := handler.NewSearchHandler(searchService, logger, validator)
+
+	accountService := service.NewAccountService(userRepo, blogRepo, tagRepo, commentRepo, sessionService, tokenService, hasher,
+		service.DeletionMode(cfg.AccountDeletionMode), cfg.AccountDeletionGrace)
+	accountHandler := handler.NewAccountHandler(accountService, logger, validator)
+
 	// Routes + Middleware
-	registerRoutes(e, cfg, logger, authHandler, blogHandler, commentHandler)
+	registerRoutes(e, cfg, logger, keys, authHandler, oidcHandler, passwordHandler, twoFactorHandler, tokenHandler, sessionHandler,
+		accountHandler, blogHandler, commentHandler, userHandler, searchHandler)
+
+	// Background workers
+	workers := []worker.Worker{
+		worker.NewScheduledPublisher(blogService, cfg.PublishInterval, logger),
+		worker.NewTrashPurger(blogService, cfg.TrashRetention, cfg.TrashPurgeInterval, logger),
+		worker.NewAccountPurger(accountService, cfg.AccountPurgeInterval, logger),
+		worker.NewLoginAttemptPurger(authService, cfg.LoginPurgeInterval, logger),
+	}
 
 	return &Server{
-		e:    e,
-		cfg:  cfg,
-		log:  logger,
-		port: cfg.ServerPort,
+		e:       e,
+		cfg:     cfg,
+		log:     logger,
+		port:    cfg.ServerPort,
+		workers: workers,
 	}
 }
 
@@ -67,6 +162,16 @@ func (s *Server) Start() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	// Workers share the signal context, so they stop as soon as shutdown begins
+	var wg sync.WaitGroup
+	for _, w := range s.workers {
+		wg.Add(1)
+		go func(w worker.Worker) {
+			defer wg.Done()
+			w.Run(ctx)
+		}(w)
+	}
+
 	go func() {
 		if err := s.e.Start(":" + s.port); err != nil && err != http.ErrServerClosed {
 			s.log.Errorw("server error",
@@ -94,4 +199,6 @@ func (s *Server) Start() {
 			"error", err,
 		)
 	}
+
+	wg.Wait()
 }
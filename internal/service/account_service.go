@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"maxwellzp/blog-api/internal/model"
+	"maxwellzp/blog-api/internal/repository"
+	"time"
+)
+
+// DeletionMode decides what happens to an account once its deletion grace
+// period is over
+type DeletionMode string
+
+const (
+	// DeletionAnonymize removes the user's blogs and personal data but keeps
+	// their comments on other users' blogs, attributed to a "deleted" user
+	DeletionAnonymize DeletionMode = "anonymize"
+	// DeletionCascade removes the user row and everything referencing it
+	DeletionCascade DeletionMode = "cascade"
+)
+
+type AccountService interface {
+	Export(ctx context.Context, userID int64) (*model.AccountExport, error)
+	RequestDeletion(ctx context.Context, userID int64, password string) (time.Time, error)
+	PurgeDue(ctx context.Context) (int, error)
+}
+
+// How many accounts a single PurgeDue call handles
+const accountPurgeBatch = 100
+
+type accountService struct {
+	userRepo    repository.UserRepository
+	blogRepo    repository.BlogRepository
+	tagRepo     repository.TagRepository
+	commentRepo repository.CommentRepository
+	sessions    SessionService
+	tokens      PersonalAccessTokenService
+	hasher      PasswordHasher
+	mode        DeletionMode
+	gracePeriod time.Duration
+}
+
+func NewAccountService(
+	userRepo repository.UserRepository,
+	blogRepo repository.BlogRepository,
+	tagRepo repository.TagRepository,
+	commentRepo repository.CommentRepository,
+	sessions SessionService,
+	tokens PersonalAccessTokenService,
+	hasher PasswordHasher,
+	mode DeletionMode,
+	gracePeriod time.Duration,
+) AccountService {
+	return &accountService{
+		userRepo:    userRepo,
+		blogRepo:    blogRepo,
+		tagRepo:     tagRepo,
+		commentRepo: commentRepo,
+		sessions:    sessions,
+		tokens:      tokens,
+		hasher:      hasher,
+		mode:        mode,
+		gracePeriod: gracePeriod,
+	}
+}
+
+// Export collects the user's profile, all their blogs including those in
+// the trash, and all their comments
+func (s *accountService) Export(ctx context.Context, userID int64) (*model.AccountExport, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	user.Password = ""
+
+	blogs, err := s.blogRepo.ListForExport(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	blogIDs := make([]int64, len(blogs))
+	for i, b := range blogs {
+		blogIDs[i] = b.ID
+	}
+	tags, err := s.tagRepo.ListByBlogIDs(ctx, blogIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range blogs {
+		b.Tags = tags[b.ID]
+		if b.Tags == nil {
+			b.Tags = []string{}
+		}
+	}
+
+	comments, err := s.commentRepo.ListForExport(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.AccountExport{
+		ExportedAt: time.Now().UTC(),
+		Profile:    user,
+		Blogs:      blogs,
+		Comments:   comments,
+	}, nil
+}
+
+// RequestDeletion schedules the account for deletion after the grace period,
+// signs it out everywhere and revokes its personal access tokens, so that
+// nothing keeps acting for the account in the meantime. Accounts without a
+// password, created through an external provider, are only protected by the
+// session requirement. Asking again keeps the original date.
+func (s *accountService) RequestDeletion(ctx context.Context, userID int64, password string) (time.Time, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if user == nil || user.DeletedAt != nil {
+		return time.Time{}, ErrUserNotFound
+	}
+	if user.Password != "" {
+		ok, err := s.hasher.Verify(password, user.Password)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !ok {
+			return time.Time{}, ErrWrongPassword
+		}
+	}
+
+	purgeAt := time.Now().Add(s.gracePeriod)
+	if user.DeletionScheduledAt != nil {
+		purgeAt = *user.DeletionScheduledAt
+	} else if err := s.userRepo.ScheduleDeletion(ctx, userID, purgeAt); err != nil {
+		return time.Time{}, err
+	}
+
+	if err := s.sessions.RevokeAllForUser(ctx, userID); err != nil {
+		return time.Time{}, err
+	}
+	if err := s.tokens.RevokeAll(ctx, userID); err != nil {
+		return time.Time{}, err
+	}
+	return purgeAt, nil
+}
+
+// PurgeDue deletes or anonymizes, depending on the mode, the accounts whose
+// grace period is over
+func (s *accountService) PurgeDue(ctx context.Context) (int, error) {
+	now := time.Now()
+	ids, err := s.userRepo.ListDueForDeletion(ctx, now, accountPurgeBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		if s.mode == DeletionCascade {
+			err = s.userRepo.Delete(ctx, id)
+		} else {
+			err = s.userRepo.Anonymize(ctx, id, now)
+		}
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
@@ -2,27 +2,132 @@ package service
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/golang-jwt/jwt/v4"
-	"golang.org/x/crypto/bcrypt"
+	"maxwellzp/blog-api/internal/jwtkeys"
 	"maxwellzp/blog-api/internal/model"
 	"maxwellzp/blog-api/internal/repository"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type AuthService interface {
 	Register(ctx context.Context, username, email, password string) (*model.User, error)
-	Login(ctx context.Context, email, password string) (*model.User, string, error)
+	Login(ctx context.Context, email, password string, client ClientInfo) (*LoginResult, error)
+	CompleteMFA(ctx context.Context, mfaToken, code string, client ClientInfo) (*LoginResult, error)
+	LoginAs(ctx context.Context, user *model.User, client ClientInfo) (*LoginResult, error)
+	Refresh(ctx context.Context, refreshToken string, client ClientInfo) (*TokenPair, error)
+	Logout(ctx context.Context, refreshToken string) error
+	PurgeLoginAttempts(ctx context.Context) (int64, error)
+}
+
+// TokenPair is what a client receives after a successful login or refresh.
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// LoginResult - Accounts with 2FA get no Tokens from Login but an MFAToken,
+// which is exchanged for tokens together with a code in CompleteMFA.
+type LoginResult struct {
+	User         *model.User
+	Tokens       *TokenPair
+	MFAToken     string
+	MFAExpiresIn int64
+}
+
+var (
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrInvalidMFAToken     = errors.New("invalid or expired mfa token")
+)
+
+// AccountLockedError is returned by Login while an email is locked out
+type AccountLockedError struct {
+	RetryAfter time.Duration
+	// Started is true when this very attempt caused the lockout
+	Started bool
+}
+
+func (e *AccountLockedError) Error() string {
+	return fmt.Sprintf("account locked, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+// LockoutPolicy - After MaxAttempts failed logins in a row an email is locked
+// for BaseLockout, doubling with every further failure up to MaxLockout.
+// Failures older than FailureWindow are forgotten.
+type LockoutPolicy struct {
+	MaxAttempts   int
+	BaseLockout   time.Duration
+	MaxLockout    time.Duration
+	FailureWindow time.Duration
+}
+
+func (p LockoutPolicy) lockoutFor(failures int) time.Duration {
+	if p.MaxAttempts < 1 || failures < p.MaxAttempts {
+		return 0
+	}
+	lockout := p.BaseLockout
+	for i := p.MaxAttempts; i < failures && lockout < p.MaxLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, p.MaxLockout)
 }
 
 type authService struct {
-	repo      repository.UserRepository
-	jwtSecret string
+	repo            repository.UserRepository
+	refreshRepo     repository.RefreshTokenRepository
+	attemptRepo     repository.LoginAttemptRepository
+	twoFactor       TwoFactorService
+	sessions        SessionService
+	hasher          PasswordHasher
+	keys            *jwtkeys.KeySet
+	mfaKey          []byte
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	mfaTokenTTL     time.Duration
+	lockout         LockoutPolicy
 }
 
-func NewAuthService(repo repository.UserRepository, jwtSecret string) AuthService {
-	return &authService{repo: repo, jwtSecret: jwtSecret}
+func NewAuthService(
+	repo repository.UserRepository,
+	refreshRepo repository.RefreshTokenRepository,
+	attemptRepo repository.LoginAttemptRepository,
+	twoFactor TwoFactorService,
+	sessions SessionService,
+	hasher PasswordHasher,
+	keys *jwtkeys.KeySet,
+	jwtSecret string,
+	accessTokenTTL time.Duration,
+	refreshTokenTTL time.Duration,
+	mfaTokenTTL time.Duration,
+	lockout LockoutPolicy,
+) AuthService {
+	// MFA tokens get their own key so they can never pass as access tokens
+	mac := hmac.New(sha256.New, []byte(jwtSecret))
+	mac.Write([]byte("mfa-challenge"))
+	return &authService{
+		repo:            repo,
+		refreshRepo:     refreshRepo,
+		attemptRepo:     attemptRepo,
+		twoFactor:       twoFactor,
+		sessions:        sessions,
+		hasher:          hasher,
+		keys:            keys,
+		mfaKey:          mac.Sum(nil),
+		accessTokenTTL:  accessTokenTTL,
+		refreshTokenTTL: refreshTokenTTL,
+		mfaTokenTTL:     mfaTokenTTL,
+		lockout:         lockout,
+	}
 }
 
 func (s *authService) Register(ctx context.Context, username, email, password string) (*model.User, error) {
@@ -41,7 +146,7 @@ func (s *authService) Register(ctx context.Context, username, email, password st
 		return nil, errors.New("email already in use")
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := s.hasher.Hash(password)
 	if err != nil {
 		return nil, err
 	}
@@ -49,7 +154,8 @@ func (s *authService) Register(ctx context.Context, username, email, password st
 	user := &model.User{
 		Username: username,
 		Email:    email,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
+		Role:     model.RoleUser,
 	}
 
 	if err := s.repo.Create(ctx, user); err != nil {
@@ -59,29 +165,296 @@ func (s *authService) Register(ctx context.Context, username, email, password st
 	return user, nil
 }
 
-func (s *authService) Login(ctx context.Context, email, password string) (*model.User, string, error) {
+func (s *authService) Login(ctx context.Context, email, password string, client ClientInfo) (*LoginResult, error) {
 	email = strings.TrimSpace(strings.ToLower(email))
+
+	// A locked email is rejected before the password is even looked at
+	if err := s.checkLockout(ctx, email); err != nil {
+		return nil, err
+	}
+
 	user, err := s.repo.FindByEmail(ctx, email)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 	if user == nil {
-		return nil, "", errors.New("invalid credentials")
+		return nil, s.loginFailed(ctx, email)
+	}
+	ok, err := s.hasher.Verify(password, user.Password)
+	if err != nil {
+		return nil, err
 	}
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, "", errors.New("invalid credentials")
+	if !ok {
+		return nil, s.loginFailed(ctx, email)
 	}
 
-	// Generate JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
-	})
-	tokenString, err := token.SignedString([]byte(s.jwtSecret))
+	// The password is only known here, so this is the one chance to move
+	// it to the current algorithm and parameters. Passwords too long for
+	// bcrypt keep their argon2id hash.
+	if s.hasher.NeedsRehash(user.Password) {
+		hashed, err := s.hasher.Hash(password)
+		if err != nil && !errors.Is(err, ErrPasswordTooLong) {
+			return nil, err
+		}
+		if err == nil {
+			if err := s.repo.UpdatePassword(ctx, user.ID, hashed); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s.LoginAs(ctx, user, client)
+}
+
+// LoginAs logs in a user whose identity was already established, by a
+// password or by an external provider. Accounts with 2FA still get an MFA
+// challenge instead of tokens.
+func (s *authService) LoginAs(ctx context.Context, user *model.User, client ClientInfo) (*LoginResult, error) {
+	user.Password = ""
+
+	// Failures are only forgotten after the second factor, otherwise a
+	// known password would allow guessing codes without ever being locked
+	if user.TwoFactorEnabled() {
+		mfaToken, err := s.signMFAToken(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{
+			User:         user,
+			MFAToken:     mfaToken,
+			MFAExpiresIn: int64(s.mfaTokenTTL.Seconds()),
+		}, nil
+	}
+	return s.completeLogin(ctx, user, client)
+}
+
+// CompleteMFA is the second step of a login for accounts with 2FA. Wrong
+// codes count as failed logins of the account's email.
+func (s *authService) CompleteMFA(ctx context.Context, mfaToken, code string, client ClientInfo) (*LoginResult, error) {
+	userID, err := s.parseMFAToken(mfaToken)
 	if err != nil {
-		return nil, "", err
+		return nil, err
+	}
+	user, err := s.repo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || !user.TwoFactorEnabled() {
+		return nil, ErrInvalidMFAToken
+	}
+	if err := s.checkLockout(ctx, user.Email); err != nil {
+		return nil, err
 	}
 
+	ok, err := s.twoFactor.VerifyCode(ctx, user, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, s.loginFailed(ctx, user.Email)
+	}
 	user.Password = ""
-	return user, tokenString, nil
+	return s.completeLogin(ctx, user, client)
+}
+
+// completeLogin clears failed attempts and starts a new session with its
+// own token family. Logging in during the grace period of an account
+// deletion cancels the deletion.
+func (s *authService) completeLogin(ctx context.Context, user *model.User, client ClientInfo) (*LoginResult, error) {
+	if err := s.attemptRepo.Reset(ctx, user.Email); err != nil {
+		return nil, err
+	}
+	if user.DeletionScheduledAt != nil {
+		if err := s.repo.CancelDeletion(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		user.DeletionScheduledAt = nil
+	}
+
+	familyID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.sessions.Start(ctx, user.ID, familyID, client)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := s.issueTokens(ctx, user, session)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{User: user, Tokens: tokens}, nil
+}
+
+func (s *authService) checkLockout(ctx context.Context, email string) error {
+	attempt, err := s.attemptRepo.FindByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if attempt != nil && attempt.LockedUntil != nil {
+		if remaining := time.Until(*attempt.LockedUntil); remaining > 0 {
+			return &AccountLockedError{RetryAfter: remaining}
+		}
+	}
+	return nil
+}
+
+func (s *authService) signMFAToken(userID int64) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   strconv.FormatInt(userID, 10),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.mfaTokenTTL)),
+	})
+	return token.SignedString(s.mfaKey)
+}
+
+func (s *authService) parseMFAToken(mfaToken string) (int64, error) {
+	claims := &jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(mfaToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return s.mfaKey, nil
+	})
+	if err != nil || !token.Valid {
+		return 0, ErrInvalidMFAToken
+	}
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidMFAToken
+	}
+	return userID, nil
+}
+
+// loginFailed records a failed attempt and returns the error for Login,
+// which is an AccountLockedError once the policy locks the email.
+func (s *authService) loginFailed(ctx context.Context, email string) error {
+	now := time.Now()
+	failures, err := s.attemptRepo.RecordFailure(ctx, email, now, s.lockout.FailureWindow)
+	if err != nil {
+		return err
+	}
+	lockout := s.lockout.lockoutFor(failures)
+	if lockout == 0 {
+		return ErrInvalidCredentials
+	}
+	if err := s.attemptRepo.Lock(ctx, email, now.Add(lockout)); err != nil {
+		return err
+	}
+	return &AccountLockedError{RetryAfter: lockout, Started: true}
+}
+
+// PurgeLoginAttempts forgets the failed logins that no longer count towards
+// a lockout
+func (s *authService) PurgeLoginAttempts(ctx context.Context) (int64, error) {
+	return s.attemptRepo.PurgeStale(ctx, time.Now(), s.lockout.FailureWindow)
+}
+
+// Refresh rotates a refresh token: the presented token is revoked and a new
+// pair from the same family is issued. Presenting a token that was already
+// rotated means it leaked, so the whole family and its session are revoked.
+func (s *authService) Refresh(ctx context.Context, refreshToken string, client ClientInfo) (*TokenPair, error) {
+	stored, err := s.refreshRepo.FindByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if stored.RevokedAt != nil {
+		if err := s.sessions.RevokeFamily(ctx, stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	revoked, err := s.refreshRepo.Revoke(ctx, stored.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !revoked {
+		// Lost a race with another request using the same token
+		if err := s.sessions.RevokeFamily(ctx, stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// Reload the user so role changes apply from the next refresh onwards
+	user, err := s.repo.FindByID(ctx, stored.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session, err := s.sessions.Resume(ctx, user.ID, stored.FamilyID, client)
+	if errors.Is(err, ErrSessionRevoked) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.issueTokens(ctx, user, session)
+}
+
+func (s *authService) Logout(ctx context.Context, refreshToken string) error {
+	stored, err := s.refreshRepo.FindByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		return ErrInvalidRefreshToken
+	}
+	return s.sessions.RevokeFamily(ctx, stored.FamilyID)
+}
+
+func (s *authService) issueTokens(ctx context.Context, user *model.User, session *model.Session) (*TokenPair, error) {
+	accessToken, err := s.keys.Sign(jwt.MapClaims{
+		"jti":            strconv.FormatInt(session.ID, 10),
+		"user_id":        user.ID,
+		"role":           string(user.Role),
+		"email_verified": user.EmailVerified(),
+		"exp":            time.Now().Add(s.accessTokenTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	err = s.refreshRepo.Create(ctx, &model.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  session.FamilyID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(s.refreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.accessTokenTTL.Seconds()),
+	}, nil
+}
+
+// randomToken returns n random bytes encoded as URL-safe base64
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken - Only the SHA-256 of an opaque token is stored, never the token itself
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
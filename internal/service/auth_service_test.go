@@ -0,0 +1,39 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutFor(t *testing.T) {
+	policy := LockoutPolicy{
+		MaxAttempts: 5,
+		BaseLockout: time.Minute,
+		MaxLockout:  10 * time.Minute,
+	}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{4, 0},
+		{5, time.Minute},
+		{6, 2 * time.Minute},
+		{7, 4 * time.Minute},
+		{8, 8 * time.Minute},
+		{9, 10 * time.Minute},
+		{1000, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := policy.lockoutFor(tt.failures); got != tt.want {
+			t.Errorf("lockoutFor(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLockoutForDisabled(t *testing.T) {
+	policy := LockoutPolicy{BaseLockout: time.Minute, MaxLockout: time.Hour}
+	if got := policy.lockoutFor(100); got != 0 {
+		t.Errorf("lockoutFor with MaxAttempts 0 = %s, want no lockout", got)
+	}
+}
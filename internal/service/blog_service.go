@@ -4,40 +4,98 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"maxwellzp/blog-api/internal/helpers"
 	"maxwellzp/blog-api/internal/model"
 	"maxwellzp/blog-api/internal/repository"
 	"strings"
+	"time"
 )
 
 type BlogService interface {
-	Create(ctx context.Context, userId int64, title, content string) (*model.Blog, error)
-	GetByID(ctx context.Context, id int64) (*model.Blog, error)
-	Delete(ctx context.Context, id int64) error
-	Update(ctx context.Context, id int64, title, content string) error
-	List(ctx context.Context, limit, offset int) ([]*model.Blog, error)
+	Create(ctx context.Context, userId int64, input BlogInput) (*model.Blog, error)
+	GetByID(ctx context.Context, id, viewerID int64) (*model.Blog, error)
+	Delete(ctx context.Context, id int64, version int) error
+	Update(ctx context.Context, id, editorID int64, version int, input BlogInput) (int, error)
+	SetStatus(ctx context.Context, id int64, version int, status model.BlogStatus) (int, error)
+	PublishDue(ctx context.Context) (int64, error)
+	List(ctx context.Context, filter model.BlogFilter, limit, offset int) ([]*model.Blog, int64, error)
+	ListByCursor(ctx context.Context, filter model.BlogFilter, ks model.Keyset) (*model.CursorPage[*model.Blog], error)
+	ListTags(ctx context.Context) ([]*model.Tag, error)
 	IsOwner(ctx context.Context, blogID, userID int64) (bool, error)
+	ListRevisions(ctx context.Context, blogID int64) ([]*model.BlogRevision, error)
+	GetRevision(ctx context.Context, blogID int64, revision int) (*model.BlogRevision, error)
+	DiffRevisions(ctx context.Context, blogID int64, from, to int) (string, error)
+	RestoreRevision(ctx context.Context, blogID int64, revision int, editorID int64, version int) (int, error)
+	ListTrash(ctx context.Context, userID int64, limit, offset int) ([]*model.Blog, error)
+	IsOwnerOfDeleted(ctx context.Context, blogID, userID int64) (bool, error)
+	Restore(ctx context.Context, id int64, version int) (int, error)
+	PurgeTrash(ctx context.Context, retention time.Duration) (int64, error)
+	ExpandAuthors(ctx context.Context, blogs []*model.Blog) error
+}
+
+// BlogInput carries the writable fields of a blog
+type BlogInput struct {
+	Title   string
+	Content string
+	// Status is only honoured on create
+	Status    model.BlogStatus
+	PublishAt *time.Time
+	// Tags replaces the blog's tags; nil leaves them unchanged on update
+	Tags []string
 }
 
 type blogService struct {
-	repo repository.BlogRepository
+	repo         repository.BlogRepository
+	tagRepo      repository.TagRepository
+	revisionRepo repository.BlogRevisionRepository
+	userRepo     repository.UserRepository
 }
 
-func NewBlogService(repo repository.BlogRepository) BlogService {
-	return &blogService{repo: repo}
+func NewBlogService(
+	repo repository.BlogRepository,
+	tagRepo repository.TagRepository,
+	revisionRepo repository.BlogRevisionRepository,
+	userRepo repository.UserRepository,
+) BlogService {
+	return &blogService{repo: repo, tagRepo: tagRepo, revisionRepo: revisionRepo, userRepo: userRepo}
 }
 
-func (s *blogService) Create(ctx context.Context, userId int64, title, content string) (*model.Blog, error) {
-	title = strings.TrimSpace(title)
-	content = strings.TrimSpace(content)
+var (
+	ErrPublishAtInPast      = errors.New("publish_at must be in the future")
+	ErrBlogAlreadyPublished = errors.New("blog is already published")
+)
+
+func (s *blogService) Create(ctx context.Context, userId int64, input BlogInput) (*model.Blog, error) {
+	title := strings.TrimSpace(input.Title)
+	content := strings.TrimSpace(input.Content)
+	publishAt := input.PublishAt
 
 	if title == "" || content == "" {
 		return nil, errors.New("title or content is empty")
 	}
+	if publishAt != nil && !publishAt.After(time.Now()) {
+		return nil, ErrPublishAtInPast
+	}
 
 	blog := &model.Blog{
 		UserID:  userId,
 		Title:   title,
 		Content: content,
+		Status:  input.Status,
+		Tags:    normalizeTags(input.Tags),
+	}
+	if blog.Status == "" {
+		blog.Status = model.BlogStatusDraft
+	}
+	if publishAt != nil {
+		// A publication time always wins over an explicit status
+		blog.Status = model.BlogStatusScheduled
+		blog.PublishAt = publishAt
+	}
+	if blog.Status == model.BlogStatusPublished {
+		now := time.Now()
+		blog.PublishedAt = &now
 	}
 
 	if err := s.repo.Create(ctx, blog); err != nil {
@@ -46,29 +104,142 @@ func (s *blogService) Create(ctx context.Context, userId int64, title, content s
 	return blog, nil
 }
 
-func (s *blogService) GetByID(ctx context.Context, id int64) (*model.Blog, error) {
-	return s.repo.GetByID(ctx, id)
+// GetByID hides unpublished blogs from everyone except their author
+func (s *blogService) GetByID(ctx context.Context, id, viewerID int64) (*model.Blog, error) {
+	blog, err := s.repo.GetVisibleByID(ctx, id, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachTags(ctx, []*model.Blog{blog}); err != nil {
+		return nil, err
+	}
+	return blog, nil
 }
 
-func (s *blogService) Update(ctx context.Context, id int64, title, content string) error {
+// ErrVersionConflict means the caller's If-Match version is stale
+var ErrVersionConflict = repository.ErrVersionConflict
+
+// Update optionally (re)schedules the blog; a blog that is already live
+// cannot be pushed back into the schedule. version is the version the caller
+// last read (0 skips the check) and the new version is returned. Content,
+// schedule and tags are saved together or not at all.
+func (s *blogService) Update(ctx context.Context, id, editorID int64, version int, input BlogInput) (int, error) {
+	title := strings.TrimSpace(input.Title)
+	content := strings.TrimSpace(input.Content)
+	publishAt := input.PublishAt
 	if title == "" || content == "" {
-		return errors.New("title and content cannot be empty")
+		return 0, errors.New("title and content cannot be empty")
+	}
+
+	if publishAt != nil {
+		if !publishAt.After(time.Now()) {
+			return 0, ErrPublishAtInPast
+		}
+		current, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			return 0, err
+		}
+		if current.Status == model.BlogStatusPublished {
+			return 0, ErrBlogAlreadyPublished
+		}
 	}
 
 	blog := &model.Blog{
-		ID:      id,
-		Title:   title,
-		Content: content,
+		ID:        id,
+		Title:     title,
+		Content:   content,
+		PublishAt: publishAt,
+	}
+	if input.Tags != nil {
+		blog.Tags = normalizeTags(input.Tags)
 	}
-	return s.repo.Update(ctx, blog)
+	if err := s.repo.Update(ctx, blog, editorID, version); err != nil {
+		return 0, err
+	}
+	return blog.Version, nil
+}
+
+// SetStatus checks and returns the version like Update
+func (s *blogService) SetStatus(ctx context.Context, id int64, version int, status model.BlogStatus) (int, error) {
+	return s.repo.UpdateStatus(ctx, id, status, version)
 }
 
-func (s *blogService) Delete(ctx context.Context, id int64) error {
-	return s.repo.Delete(ctx, id)
+func (s *blogService) PublishDue(ctx context.Context) (int64, error) {
+	return s.repo.PublishDue(ctx, time.Now())
+}
+
+func (s *blogService) Delete(ctx context.Context, id int64, version int) error {
+	return s.repo.Delete(ctx, id, version)
+}
+
+// List returns one page of blogs along with the total across all pages
+func (s *blogService) List(ctx context.Context, filter model.BlogFilter, limit, offset int) ([]*model.Blog, int64, error) {
+	filter.Tag = strings.ToLower(strings.TrimSpace(filter.Tag))
+	total, err := s.repo.Count(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	blogs, err := s.repo.List(ctx, filter, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := s.attachTags(ctx, blogs); err != nil {
+		return nil, 0, err
+	}
+	return blogs, total, nil
+}
+
+func (s *blogService) ListByCursor(ctx context.Context, filter model.BlogFilter, ks model.Keyset) (*model.CursorPage[*model.Blog], error) {
+	filter.Tag = strings.ToLower(strings.TrimSpace(filter.Tag))
+	lookahead := ks
+	lookahead.Limit++
+	blogs, err := s.repo.ListByKeyset(ctx, filter, lookahead)
+	if err != nil {
+		return nil, err
+	}
+	page := keysetPage(blogs, ks, func(b *model.Blog) int64 { return b.ID })
+	if err := s.attachTags(ctx, page.Items); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (s *blogService) ListTags(ctx context.Context) ([]*model.Tag, error) {
+	return s.tagRepo.ListWithCounts(ctx)
+}
+
+// attachTags loads the tags of all given blogs with a single query
+func (s *blogService) attachTags(ctx context.Context, blogs []*model.Blog) error {
+	ids := make([]int64, len(blogs))
+	for i, blog := range blogs {
+		ids[i] = blog.ID
+	}
+	tags, err := s.tagRepo.ListByBlogIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, blog := range blogs {
+		blog.Tags = tags[blog.ID]
+		if blog.Tags == nil {
+			blog.Tags = []string{}
+		}
+	}
+	return nil
 }
 
-func (s *blogService) List(ctx context.Context, limit, offset int) ([]*model.Blog, error) {
-	return s.repo.List(ctx, limit, offset)
+// normalizeTags lowercases, trims and de-duplicates tag names
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
 }
 
 var ErrBlogNotFound = errors.New("blog not found")
@@ -83,3 +254,107 @@ func (s *blogService) IsOwner(ctx context.Context, blogID, userID int64) (bool,
 	}
 	return blog.UserID == userID, nil
 }
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+func (s *blogService) ListRevisions(ctx context.Context, blogID int64) ([]*model.BlogRevision, error) {
+	return s.revisionRepo.ListByBlogID(ctx, blogID)
+}
+
+func (s *blogService) GetRevision(ctx context.Context, blogID int64, revision int) (*model.BlogRevision, error) {
+	rev, err := s.revisionRepo.Get(ctx, blogID, revision)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, err
+	}
+	return rev, nil
+}
+
+// DiffRevisions compares the title and content of two revisions as one
+// document. Revisions with too many changed lines give helpers.ErrDiffTooLarge.
+func (s *blogService) DiffRevisions(ctx context.Context, blogID int64, from, to int) (string, error) {
+	fromRev, err := s.GetRevision(ctx, blogID, from)
+	if err != nil {
+		return "", err
+	}
+	toRev, err := s.GetRevision(ctx, blogID, to)
+	if err != nil {
+		return "", err
+	}
+	return helpers.UnifiedDiff(
+		fmt.Sprintf("revision %d", from),
+		fmt.Sprintf("revision %d", to),
+		fromRev.Title+"\n\n"+fromRev.Content,
+		toRev.Title+"\n\n"+toRev.Content,
+	)
+}
+
+// RestoreRevision copies an old revision back into the blog. The restore is
+// itself recorded as a new revision, so it can be undone as well. The version
+// is checked and returned like Update.
+func (s *blogService) RestoreRevision(ctx context.Context, blogID int64, revision int, editorID int64, version int) (int, error) {
+	rev, err := s.GetRevision(ctx, blogID, revision)
+	if err != nil {
+		return 0, err
+	}
+	blog := &model.Blog{
+		ID:      blogID,
+		Title:   rev.Title,
+		Content: rev.Content,
+	}
+	if err := s.repo.Update(ctx, blog, editorID, version); err != nil {
+		return 0, err
+	}
+	return blog.Version, nil
+}
+
+func (s *blogService) ListTrash(ctx context.Context, userID int64, limit, offset int) ([]*model.Blog, error) {
+	blogs, err := s.repo.ListDeletedByUserID(ctx, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachTags(ctx, blogs); err != nil {
+		return nil, err
+	}
+	return blogs, nil
+}
+
+// IsOwnerOfDeleted is IsOwner for blogs in the trash
+func (s *blogService) IsOwnerOfDeleted(ctx context.Context, blogID, userID int64) (bool, error) {
+	blog, err := s.repo.GetDeletedByID(ctx, blogID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrBlogNotFound
+		}
+		return false, err
+	}
+	return blog.UserID == userID, nil
+}
+
+func (s *blogService) Restore(ctx context.Context, id int64, version int) (int, error) {
+	return s.repo.Restore(ctx, id, version)
+}
+
+// PurgeTrash permanently removes blogs that have been in the trash longer
+// than retention.
+func (s *blogService) PurgeTrash(ctx context.Context, retention time.Duration) (int64, error) {
+	return s.repo.PurgeDeletedBefore(ctx, time.Now().Add(-retention))
+}
+
+// ExpandAuthors fills in the author summary of every blog with a single query
+func (s *blogService) ExpandAuthors(ctx context.Context, blogs []*model.Blog) error {
+	ids := make([]int64, 0, len(blogs))
+	for _, blog := range blogs {
+		ids = append(ids, blog.UserID)
+	}
+	authors, err := s.userRepo.ListSummariesByIDs(ctx, uniqueIDs(ids))
+	if err != nil {
+		return err
+	}
+	for _, blog := range blogs {
+		blog.Author = authors[blog.UserID]
+	}
+	return nil
+}
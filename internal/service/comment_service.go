@@ -10,32 +10,84 @@ import (
 )
 
 type CommentService interface {
-	Create(ctx context.Context, userID, blogID int64, content string) (*model.Comment, error)
-	GetByID(ctx context.Context, id int64) (*model.Comment, error)
-	Update(ctx context.Context, id int64, content string) error
-	Delete(ctx context.Context, id int64) error
-	ListByBlogID(ctx context.Context, blogID int64, limit, offset int) ([]*model.Comment, error)
+	Create(ctx context.Context, userID, blogID int64, parentID *int64, content string) (*model.Comment, error)
+	GetByID(ctx context.Context, id, viewerID int64) (*model.Comment, error)
+	Update(ctx context.Context, id int64, version int, content string) (int, error)
+	Delete(ctx context.Context, id int64, version int) error
+	ListByBlogID(ctx context.Context, blogID, viewerID int64, limit, offset int) ([]*model.Comment, int64, error)
+	ListByBlogIDCursor(ctx context.Context, blogID, viewerID int64, ks model.Keyset) (*model.CursorPage[*model.Comment], error)
+	ListThreadsByBlogID(ctx context.Context, blogID, viewerID int64, depth, limit, offset int) ([]*model.Comment, int64, error)
 	IsOwner(ctx context.Context, commentID, userID int64) (bool, error)
+	ExpandAuthors(ctx context.Context, comments []*model.Comment) error
+	ExpandBlogs(ctx context.Context, comments []*model.Comment, viewerID int64) error
 }
 
+var (
+	ErrInvalidParentComment = errors.New("parent comment not found on this blog")
+	ErrReplyTooDeep         = errors.New("replies cannot be nested any deeper")
+)
+
 type commentService struct {
-	repo repository.CommentRepository
+	repo     repository.CommentRepository
+	blogRepo repository.BlogRepository
+	userRepo repository.UserRepository
+	maxDepth int
 }
 
-func NewCommentService(repo repository.CommentRepository) CommentService {
-	return &commentService{repo: repo}
+func NewCommentService(
+	repo repository.CommentRepository,
+	blogRepo repository.BlogRepository,
+	userRepo repository.UserRepository,
+	maxDepth int,
+) CommentService {
+	return &commentService{repo: repo, blogRepo: blogRepo, userRepo: userRepo, maxDepth: maxDepth}
+}
+
+// checkBlogVisible - Comments share the visibility of their blog, so that
+// the discussion of a draft does not give it away. Returns ErrBlogNotFound.
+func (s *commentService) checkBlogVisible(ctx context.Context, blogID, viewerID int64) error {
+	_, err := s.blogRepo.GetVisibleByID(ctx, blogID, viewerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrBlogNotFound
+	}
+	return err
 }
 
-func (s *commentService) Create(ctx context.Context, userID, blogID int64, content string) (*model.Comment, error) {
+func (s *commentService) Create(ctx context.Context, userID, blogID int64, parentID *int64, content string) (*model.Comment, error) {
 	content = strings.TrimSpace(content)
 	if content == "" {
 		return nil, errors.New("content is empty")
 	}
+	if err := s.checkBlogVisible(ctx, blogID, userID); err != nil {
+		return nil, err
+	}
+
+	if parentID != nil {
+		parent, err := s.repo.GetByID(ctx, *parentID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, ErrInvalidParentComment
+			}
+			return nil, err
+		}
+		if parent.BlogID != blogID {
+			return nil, ErrInvalidParentComment
+		}
+		// Replies deeper than the threaded listing shows would never be seen
+		depth, err := s.repo.Depth(ctx, parent.ID)
+		if err != nil {
+			return nil, err
+		}
+		if depth+1 > s.maxDepth {
+			return nil, ErrReplyTooDeep
+		}
+	}
 
 	comment := &model.Comment{
-		UserID:  userID,
-		BlogID:  blogID,
-		Content: content,
+		UserID:   userID,
+		BlogID:   blogID,
+		ParentID: parentID,
+		Content:  content,
 	}
 
 	if err := s.repo.Create(ctx, comment); err != nil {
@@ -44,29 +96,113 @@ func (s *commentService) Create(ctx context.Context, userID, blogID int64, conte
 	return comment, nil
 }
 
-func (s *commentService) GetByID(ctx context.Context, id int64) (*model.Comment, error) {
-	return s.repo.GetByID(ctx, id)
+func (s *commentService) GetByID(ctx context.Context, id, viewerID int64) (*model.Comment, error) {
+	comment, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCommentNotFound
+		}
+		return nil, err
+	}
+	if err := s.checkBlogVisible(ctx, comment.BlogID, viewerID); err != nil {
+		if errors.Is(err, ErrBlogNotFound) {
+			return nil, ErrCommentNotFound
+		}
+		return nil, err
+	}
+	return comment, nil
 }
 
-func (s *commentService) Update(ctx context.Context, id int64, content string) error {
+// Update works like blogService.Update: version 0 skips the check and the
+// new version is returned.
+func (s *commentService) Update(ctx context.Context, id int64, version int, content string) (int, error) {
 	content = strings.TrimSpace(content)
 	if content == "" {
-		return errors.New("content cannot be empty")
+		return 0, errors.New("content cannot be empty")
 	}
 
 	comment := &model.Comment{
 		ID:      id,
 		Content: content,
 	}
-	return s.repo.Update(ctx, comment)
+	if err := s.repo.Update(ctx, comment, version); err != nil {
+		return 0, err
+	}
+	return comment.Version, nil
 }
 
-func (s *commentService) Delete(ctx context.Context, id int64) error {
-	return s.repo.Delete(ctx, id)
+// Delete keeps the comment's replies; they become top-level comments
+func (s *commentService) Delete(ctx context.Context, id int64, version int) error {
+	return s.repo.Delete(ctx, id, version)
 }
 
-func (s *commentService) ListByBlogID(ctx context.Context, blogID int64, limit, offset int) ([]*model.Comment, error) {
-	return s.repo.ListByBlogID(ctx, blogID, limit, offset)
+func (s *commentService) ListByBlogID(ctx context.Context, blogID, viewerID int64, limit, offset int) ([]*model.Comment, int64, error) {
+	if err := s.checkBlogVisible(ctx, blogID, viewerID); err != nil {
+		return nil, 0, err
+	}
+	total, err := s.repo.CountByBlogID(ctx, blogID)
+	if err != nil {
+		return nil, 0, err
+	}
+	comments, err := s.repo.ListByBlogID(ctx, blogID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return comments, total, nil
+}
+
+func (s *commentService) ListByBlogIDCursor(ctx context.Context, blogID, viewerID int64, ks model.Keyset) (*model.CursorPage[*model.Comment], error) {
+	if err := s.checkBlogVisible(ctx, blogID, viewerID); err != nil {
+		return nil, err
+	}
+	lookahead := ks
+	lookahead.Limit++
+	comments, err := s.repo.ListByBlogIDKeyset(ctx, blogID, lookahead)
+	if err != nil {
+		return nil, err
+	}
+	return keysetPage(comments, ks, func(c *model.Comment) int64 { return c.ID }), nil
+}
+
+// ListThreadsByBlogID pages through top-level comments and nests their
+// replies up to depth levels deep. depth is capped at the configured maximum.
+// The returned total counts top-level comments only.
+func (s *commentService) ListThreadsByBlogID(ctx context.Context, blogID, viewerID int64, depth, limit, offset int) ([]*model.Comment, int64, error) {
+	if depth < 0 || depth > s.maxDepth {
+		depth = s.maxDepth
+	}
+	if err := s.checkBlogVisible(ctx, blogID, viewerID); err != nil {
+		return nil, 0, err
+	}
+
+	total, err := s.repo.CountRootsByBlogID(ctx, blogID)
+	if err != nil {
+		return nil, 0, err
+	}
+	roots, err := s.repo.ListRootsByBlogID(ctx, blogID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rootIDs := make([]int64, len(roots))
+	byID := make(map[int64]*model.Comment, len(roots))
+	for i, root := range roots {
+		rootIDs[i] = root.ID
+		byID[root.ID] = root
+	}
+
+	replies, err := s.repo.ListReplies(ctx, rootIDs, depth)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Replies come oldest first, so a parent is always seen before its children
+	for _, reply := range replies {
+		byID[reply.ID] = reply
+		if parent, ok := byID[*reply.ParentID]; ok {
+			parent.Replies = append(parent.Replies, reply)
+		}
+	}
+	return roots, total, nil
 }
 
 var ErrCommentNotFound = errors.New("comment not found")
@@ -81,3 +217,49 @@ func (s *commentService) IsOwner(ctx context.Context, commentID, userID int64) (
 	}
 	return comment.UserID == userID, nil
 }
+
+// ExpandAuthors fills in the author summary of every comment, replies
+// included, with a single query.
+func (s *commentService) ExpandAuthors(ctx context.Context, comments []*model.Comment) error {
+	all := flattenThreads(comments)
+	ids := make([]int64, 0, len(all))
+	for _, c := range all {
+		ids = append(ids, c.UserID)
+	}
+	authors, err := s.userRepo.ListSummariesByIDs(ctx, uniqueIDs(ids))
+	if err != nil {
+		return err
+	}
+	for _, c := range all {
+		c.Author = authors[c.UserID]
+	}
+	return nil
+}
+
+// ExpandBlogs fills in the blog summary of every comment, replies included,
+// with a single query. Blogs the viewer may not see stay nil.
+func (s *commentService) ExpandBlogs(ctx context.Context, comments []*model.Comment, viewerID int64) error {
+	all := flattenThreads(comments)
+	ids := make([]int64, 0, len(all))
+	for _, c := range all {
+		ids = append(ids, c.BlogID)
+	}
+	blogs, err := s.blogRepo.ListSummariesByIDs(ctx, uniqueIDs(ids), viewerID)
+	if err != nil {
+		return err
+	}
+	for _, c := range all {
+		c.Blog = blogs[c.BlogID]
+	}
+	return nil
+}
+
+// flattenThreads returns the comments together with all of their nested replies
+func flattenThreads(comments []*model.Comment) []*model.Comment {
+	var all []*model.Comment
+	for _, c := range comments {
+		all = append(all, c)
+		all = append(all, flattenThreads(c.Replies)...)
+	}
+	return all
+}
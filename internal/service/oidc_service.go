@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"github.com/golang-jwt/jwt/v4"
+	"maxwellzp/blog-api/internal/model"
+	"maxwellzp/blog-api/internal/oidc"
+	"maxwellzp/blog-api/internal/repository"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type OIDCService interface {
+	Providers() []string
+	Begin(ctx context.Context, provider string) (*OIDCAuthRequest, error)
+	Complete(ctx context.Context, provider, code, state, stateToken string, client ClientInfo) (*LoginResult, error)
+}
+
+// OIDCAuthRequest - The browser is sent to URL while StateToken is kept in a
+// cookie until the provider redirects back.
+type OIDCAuthRequest struct {
+	URL        string
+	StateToken string
+}
+
+var (
+	ErrUnknownOIDCProvider  = errors.New("unknown login provider")
+	ErrInvalidOIDCState     = errors.New("invalid or expired login state")
+	ErrOIDCEmailNotVerified = errors.New("the provider did not confirm a verified email address")
+	// The email belongs to an account that never proved owning it, so it
+	// may have been registered by someone else
+	ErrOIDCAccountNotVerified = errors.New("an unverified account already uses this email address")
+)
+
+// Usernames follow the rules of registerRequest
+const (
+	minUsernameLength = 5
+	maxUsernameLength = 30
+)
+
+type oidcStateClaims struct {
+	jwt.RegisteredClaims
+	Provider     string `json:"provider"`
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+type oidcService struct {
+	providers    map[string]*oidc.Provider
+	auth         AuthService
+	userRepo     repository.UserRepository
+	identityRepo repository.UserIdentityRepository
+	stateKey     []byte
+	stateTTL     time.Duration
+}
+
+// NewOIDCService signs the login state with a key derived from secret, so a
+// state token can never pass as an access token or the other way round.
+func NewOIDCService(
+	providers map[string]*oidc.Provider,
+	auth AuthService,
+	userRepo repository.UserRepository,
+	identityRepo repository.UserIdentityRepository,
+	secret string,
+	stateTTL time.Duration,
+) OIDCService {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("oidc-state"))
+	return &oidcService{
+		providers:    providers,
+		auth:         auth,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		stateKey:     mac.Sum(nil),
+		stateTTL:     stateTTL,
+	}
+}
+
+func (s *oidcService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Begin starts the authorization code flow. The PKCE verifier and nonce only
+// ever live in the signed state token, never in the URL.
+func (s *oidcService) Begin(ctx context.Context, provider string) (*OIDCAuthRequest, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+
+	claims := &oidcStateClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.stateTTL)),
+		},
+		Provider: provider,
+	}
+	var err error
+	if claims.State, err = randomToken(16); err != nil {
+		return nil, err
+	}
+	if claims.Nonce, err = randomToken(16); err != nil {
+		return nil, err
+	}
+	if claims.CodeVerifier, err = oidc.NewCodeVerifier(); err != nil {
+		return nil, err
+	}
+
+	authURL, err := p.AuthCodeURL(ctx, claims.State, claims.Nonce, oidc.CodeChallenge(claims.CodeVerifier))
+	if err != nil {
+		return nil, err
+	}
+	stateToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.stateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCAuthRequest{URL: authURL, StateToken: stateToken}, nil
+}
+
+// Complete handles the redirect back from the provider. The user behind the
+// ID token is found by a linked identity, then by verified email, and is
+// created when neither exists.
+func (s *oidcService) Complete(ctx context.Context, provider, code, state, stateToken string, client ClientInfo) (*LoginResult, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+
+	stored, err := s.parseState(stateToken)
+	if err != nil {
+		return nil, err
+	}
+	if stored.Provider != provider || subtle.ConstantTimeCompare([]byte(stored.State), []byte(state)) != 1 {
+		return nil, ErrInvalidOIDCState
+	}
+
+	claims, err := p.Exchange(ctx, code, stored.CodeVerifier, stored.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.resolveUser(ctx, provider, claims)
+	if err != nil {
+		return nil, err
+	}
+	return s.auth.LoginAs(ctx, user, client)
+}
+
+// resolveUser finds the user linked to the identity, links it to the
+// verified account with the same email, or creates an account. A first
+// login racing another one for the same identity or email loses on a unique
+// key and then finds what the other one created.
+func (s *oidcService) resolveUser(ctx context.Context, provider string, claims *oidc.Claims) (*model.User, error) {
+	user, err := s.findOrCreateUser(ctx, provider, claims)
+	if errors.Is(err, repository.ErrDuplicate) {
+		return s.findOrCreateUser(ctx, provider, claims)
+	}
+	return user, err
+}
+
+func (s *oidcService) findOrCreateUser(ctx context.Context, provider string, claims *oidc.Claims) (*model.User, error) {
+	identity, err := s.identityRepo.FindBySubject(ctx, provider, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		user, err := s.userRepo.FindByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, ErrUserNotFound
+		}
+		return user, nil
+	}
+
+	email := strings.TrimSpace(strings.ToLower(claims.Email))
+	if email == "" || !claims.EmailVerified {
+		return nil, ErrOIDCEmailNotVerified
+	}
+
+	user, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil && !user.EmailVerified() {
+		return nil, ErrOIDCAccountNotVerified
+	}
+
+	identity = &model.UserIdentity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    email,
+	}
+	if user == nil {
+		return s.createUser(ctx, email, claims, identity)
+	}
+	identity.UserID = user.ID
+	if err := s.identityRepo.Create(ctx, identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// createUser creates an account without a password, linked to identity. One
+// can be set later through the password reset flow.
+func (s *oidcService) createUser(ctx context.Context, email string, claims *oidc.Claims, identity *model.UserIdentity) (*model.User, error) {
+	username, err := usernameFromClaims(email, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := &model.User{
+		Username:        username,
+		Email:           email,
+		Role:            model.RoleUser,
+		EmailVerifiedAt: &now,
+		DisplayName:     truncateRunes(strings.TrimSpace(claims.Name), 100),
+	}
+	if u, err := url.Parse(claims.Picture); err == nil && u.Scheme == "https" && u.Host != "" && len(claims.Picture) <= 2048 {
+		user.AvatarURL = claims.Picture
+	}
+	if err := s.identityRepo.CreateWithUser(ctx, user, identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *oidcService) parseState(stateToken string) (*oidcStateClaims, error) {
+	claims := &oidcStateClaims{}
+	token, err := jwt.ParseWithClaims(stateToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return s.stateKey, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidOIDCState
+	}
+	return claims, nil
+}
+
+// usernameFromClaims picks the first usable name the provider offers and
+// keeps only letters and digits. Short names get a random suffix; usernames
+// are not unique, so no further checks are needed.
+func usernameFromClaims(email string, claims *oidc.Claims) (string, error) {
+	localPart, _, _ := strings.Cut(email, "@")
+	var username string
+	for _, candidate := range []string{claims.PreferredUsername, claims.Name, localPart} {
+		username = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, candidate)
+		if username != "" {
+			break
+		}
+	}
+	username = truncateRunes(username, maxUsernameLength)
+
+	if len([]rune(username)) < minUsernameLength {
+		// Recovery codes happen to be random and easy to read
+		suffix, err := newRecoveryCode()
+		if err != nil {
+			return "", err
+		}
+		if username == "" {
+			username = "user"
+		}
+		username += strings.ReplaceAll(suffix, "-", "")[:minUsernameLength]
+	}
+	return username, nil
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
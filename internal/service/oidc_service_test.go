@@ -0,0 +1,330 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"maxwellzp/blog-api/internal/model"
+	"maxwellzp/blog-api/internal/oidc"
+	"maxwellzp/blog-api/internal/oidc/oidctest"
+	"maxwellzp/blog-api/internal/repository"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fakeUserRepo keeps users in memory; methods the OIDC flow does not use
+// panic through the nil embedded interface.
+type fakeUserRepo struct {
+	repository.UserRepository
+	users map[int64]*model.User
+}
+
+func newFakeUserRepo() *fakeUserRepo {
+	return &fakeUserRepo{users: make(map[int64]*model.User)}
+}
+
+func (r *fakeUserRepo) Create(ctx context.Context, user *model.User) error {
+	user.ID = int64(len(r.users) + 1)
+	stored := *user
+	r.users[user.ID] = &stored
+	return nil
+}
+
+func (r *fakeUserRepo) FindByID(ctx context.Context, id int64) (*model.User, error) {
+	if user, ok := r.users[id]; ok {
+		found := *user
+		return &found, nil
+	}
+	return nil, nil
+}
+
+func (r *fakeUserRepo) FindByEmail(ctx context.Context, email string) (*model.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+// fakeIdentityRepo enforces the unique keys on the identity subject and
+// the user email like the database does
+type fakeIdentityRepo struct {
+	users      *fakeUserRepo
+	identities []*model.UserIdentity
+	// beforeWrite runs before each write, e.g. to let a concurrent login win
+	beforeWrite func()
+}
+
+func (r *fakeIdentityRepo) Create(ctx context.Context, identity *model.UserIdentity) error {
+	if r.beforeWrite != nil {
+		r.beforeWrite()
+	}
+	if found, _ := r.FindBySubject(ctx, identity.Provider, identity.Subject); found != nil {
+		return repository.ErrDuplicate
+	}
+	identity.ID = int64(len(r.identities) + 1)
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *fakeIdentityRepo) CreateWithUser(ctx context.Context, user *model.User, identity *model.UserIdentity) error {
+	if r.beforeWrite != nil {
+		r.beforeWrite()
+	}
+	if found, _ := r.users.FindByEmail(ctx, user.Email); found != nil {
+		return repository.ErrDuplicate
+	}
+	if found, _ := r.FindBySubject(ctx, identity.Provider, identity.Subject); found != nil {
+		return repository.ErrDuplicate
+	}
+	_ = r.users.Create(ctx, user)
+	identity.UserID = user.ID
+	identity.ID = int64(len(r.identities) + 1)
+	r.identities = append(r.identities, identity)
+	return nil
+}
+
+func (r *fakeIdentityRepo) FindBySubject(ctx context.Context, provider, subject string) (*model.UserIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, nil
+}
+
+// fakeAuth logs in whoever the OIDC service resolved, without tokens
+type fakeAuth struct {
+	AuthService
+}
+
+func (a *fakeAuth) LoginAs(ctx context.Context, user *model.User, client ClientInfo) (*LoginResult, error) {
+	return &LoginResult{User: user}, nil
+}
+
+type oidcTestEnv struct {
+	service    OIDCService
+	provider   *oidctest.Server
+	users      *fakeUserRepo
+	identities *fakeIdentityRepo
+}
+
+func newOIDCTestEnv(t *testing.T, stateTTL time.Duration) *oidcTestEnv {
+	t.Helper()
+	srv := oidctest.NewServer(t)
+	providers := map[string]*oidc.Provider{
+		"mock": oidc.NewProvider(oidc.Config{
+			Issuer:       srv.Issuer(),
+			ClientID:     srv.ClientID,
+			ClientSecret: srv.ClientSecret,
+			RedirectURL:  "http://localhost:8080/auth/oidc/mock/callback",
+		}),
+	}
+	users := newFakeUserRepo()
+	env := &oidcTestEnv{provider: srv, users: users, identities: &fakeIdentityRepo{users: users}}
+	env.service = NewOIDCService(providers, &fakeAuth{}, env.users, env.identities, "test-secret", stateTTL)
+	return env
+}
+
+// login runs Begin, the provider login and Complete with the state the
+// provider hands back
+func (env *oidcTestEnv) login(t *testing.T, identity oidctest.Identity) (*LoginResult, error) {
+	t.Helper()
+	req, err := env.service.Begin(context.Background(), "mock")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	code, state := env.provider.Authorize(t, req.URL, identity)
+	return env.service.Complete(context.Background(), "mock", code, state, req.StateToken, ClientInfo{})
+}
+
+func TestOIDCBeginKeepsSecretsOutOfURL(t *testing.T) {
+	env := newOIDCTestEnv(t, 10*time.Minute)
+	req, err := env.service.Begin(context.Background(), "mock")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Query().Get("code_challenge_method") != "S256" || u.Query().Get("code_challenge") == "" {
+		t.Errorf("authorization URL has no S256 code challenge: %s", req.URL)
+	}
+	if u.Query().Has("code_verifier") {
+		t.Errorf("authorization URL leaks the code verifier: %s", req.URL)
+	}
+
+	if _, err := env.service.Begin(context.Background(), "unknown"); !errors.Is(err, ErrUnknownOIDCProvider) {
+		t.Errorf("Begin with unknown provider error = %v, want ErrUnknownOIDCProvider", err)
+	}
+}
+
+func TestOIDCCreatesUserOnFirstLogin(t *testing.T) {
+	env := newOIDCTestEnv(t, 10*time.Minute)
+	identity := oidctest.Identity{
+		Subject:           "subject-1",
+		Email:             "Jane@Example.com",
+		EmailVerified:     true,
+		Name:              "Jane Doe",
+		PreferredUsername: "jane.doe",
+	}
+
+	result, err := env.login(t, identity)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	user := result.User
+	if user.Email != "jane@example.com" || user.Username != "janedoe" || user.DisplayName != "Jane Doe" {
+		t.Errorf("unexpected user %+v", user)
+	}
+	if user.Password != "" || !user.EmailVerified() {
+		t.Errorf("created user should have no password and a verified email: %+v", user)
+	}
+	if len(env.identities.identities) != 1 || env.identities.identities[0].UserID != user.ID {
+		t.Fatalf("identity not linked: %+v", env.identities.identities)
+	}
+
+	// The second login finds the user through the linked identity
+	again, err := env.login(t, identity)
+	if err != nil {
+		t.Fatalf("second Complete: %v", err)
+	}
+	if again.User.ID != user.ID || len(env.users.users) != 1 || len(env.identities.identities) != 1 {
+		t.Errorf("second login created user %d, %d users, %d identities",
+			again.User.ID, len(env.users.users), len(env.identities.identities))
+	}
+}
+
+func TestOIDCLinksVerifiedUser(t *testing.T) {
+	env := newOIDCTestEnv(t, 10*time.Minute)
+	verifiedAt := time.Now()
+	existing := &model.User{Username: "jane", Email: "jane@example.com", Password: "hash", EmailVerifiedAt: &verifiedAt}
+	_ = env.users.Create(context.Background(), existing)
+
+	result, err := env.login(t, oidctest.Identity{Subject: "subject-1", Email: "jane@example.com", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if result.User.ID != existing.ID || len(env.users.users) != 1 {
+		t.Errorf("logged in as %d with %d users, want existing user %d", result.User.ID, len(env.users.users), existing.ID)
+	}
+	if len(env.identities.identities) != 1 || env.identities.identities[0].UserID != existing.ID {
+		t.Errorf("identity not linked to the existing user: %+v", env.identities.identities)
+	}
+}
+
+func TestOIDCRefusesUnverifiedAccount(t *testing.T) {
+	env := newOIDCTestEnv(t, 10*time.Minute)
+	_ = env.users.Create(context.Background(), &model.User{Username: "jane", Email: "jane@example.com", Password: "hash"})
+
+	_, err := env.login(t, oidctest.Identity{Subject: "subject-1", Email: "jane@example.com", EmailVerified: true})
+	if !errors.Is(err, ErrOIDCAccountNotVerified) {
+		t.Fatalf("Complete error = %v, want ErrOIDCAccountNotVerified", err)
+	}
+	if len(env.identities.identities) != 0 {
+		t.Errorf("identity linked to an unverified account")
+	}
+}
+
+func TestOIDCRequiresVerifiedEmail(t *testing.T) {
+	env := newOIDCTestEnv(t, 10*time.Minute)
+
+	_, err := env.login(t, oidctest.Identity{Subject: "subject-1", Email: "jane@example.com"})
+	if !errors.Is(err, ErrOIDCEmailNotVerified) {
+		t.Fatalf("Complete error = %v, want ErrOIDCEmailNotVerified", err)
+	}
+	if len(env.users.users) != 0 {
+		t.Errorf("user created without a verified email")
+	}
+}
+
+func TestOIDCRejectsStateMismatch(t *testing.T) {
+	env := newOIDCTestEnv(t, 10*time.Minute)
+	identity := oidctest.Identity{Subject: "subject-1", Email: "jane@example.com", EmailVerified: true}
+
+	req, err := env.service.Begin(context.Background(), "mock")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	other, err := env.service.Begin(context.Background(), "mock")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	code, state := env.provider.Authorize(t, req.URL, identity)
+
+	tests := []struct {
+		name       string
+		state      string
+		stateToken string
+	}{
+		{"state of another login", state, other.StateToken},
+		{"forged state", "forged", req.StateToken},
+		{"tampered state token", state, req.StateToken + "x"},
+		{"missing state token", state, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := env.service.Complete(context.Background(), "mock", code, tt.state, tt.stateToken, ClientInfo{})
+			if !errors.Is(err, ErrInvalidOIDCState) {
+				t.Fatalf("Complete error = %v, want ErrInvalidOIDCState", err)
+			}
+		})
+	}
+	if len(env.users.users) != 0 {
+		t.Errorf("user created despite an invalid state")
+	}
+}
+
+func TestOIDCRejectsExpiredState(t *testing.T) {
+	env := newOIDCTestEnv(t, -time.Second)
+
+	_, err := env.login(t, oidctest.Identity{Subject: "subject-1", Email: "jane@example.com", EmailVerified: true})
+	if !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("Complete error = %v, want ErrInvalidOIDCState", err)
+	}
+}
+
+func TestOIDCRejectsNonceMismatch(t *testing.T) {
+	env := newOIDCTestEnv(t, 10*time.Minute)
+
+	_, err := env.login(t, oidctest.Identity{
+		Subject:       "subject-1",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		Nonce:         "replayed",
+	})
+	if !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Fatalf("Complete error = %v, want oidc.ErrInvalidIDToken", err)
+	}
+	if len(env.users.users) != 0 {
+		t.Errorf("user created from an ID token with the wrong nonce")
+	}
+}
+
+func TestOIDCConcurrentFirstLogin(t *testing.T) {
+	env := newOIDCTestEnv(t, 10*time.Minute)
+	identity := oidctest.Identity{Subject: "subject-1", Email: "jane@example.com", EmailVerified: true}
+
+	// Another request for the same identity creates the account between
+	// the lookups and the insert of this one
+	var winner *model.User
+	env.identities.beforeWrite = func() {
+		env.identities.beforeWrite = nil
+		verifiedAt := time.Now()
+		winner = &model.User{Username: "jane", Email: "jane@example.com", EmailVerifiedAt: &verifiedAt}
+		_ = env.identities.CreateWithUser(context.Background(), winner,
+			&model.UserIdentity{Provider: "mock", Subject: "subject-1", Email: "jane@example.com"})
+	}
+
+	result, err := env.login(t, identity)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if result.User.ID != winner.ID || len(env.users.users) != 1 || len(env.identities.identities) != 1 {
+		t.Errorf("logged in as %d with %d users and %d identities, want the user %d created concurrently",
+			result.User.ID, len(env.users.users), len(env.identities.identities), winner.ID)
+	}
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"maxwellzp/blog-api/internal/helpers"
+	"maxwellzp/blog-api/internal/model"
+)
+
+// keysetPage turns rows fetched with Limit+1 into a page. The extra row only
+// signals that more rows exist in the requested direction.
+func keysetPage[T any](rows []T, ks model.Keyset, idOf func(T) int64) *model.CursorPage[T] {
+	hasMore := len(rows) > ks.Limit
+	if hasMore {
+		if ks.Backward {
+			// Rows are newest first, so the look-ahead row is at the front
+			rows = rows[1:]
+		} else {
+			rows = rows[:ks.Limit]
+		}
+	}
+
+	page := &model.CursorPage[T]{Items: rows}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	if len(rows) == 0 {
+		return page
+	}
+
+	// Having started from a cursor means there is something on the other side
+	if hasMore && !ks.Backward || ks.Backward && ks.ID > 0 {
+		next := helpers.EncodeCursor(idOf(rows[len(rows)-1]), false)
+		page.NextCursor = &next
+	}
+	if hasMore && ks.Backward || !ks.Backward && ks.ID > 0 {
+		prev := helpers.EncodeCursor(idOf(rows[0]), true)
+		page.PrevCursor = &prev
+	}
+	return page
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// PasswordHasher hashes new passwords with one algorithm but verifies hashes
+// of every supported algorithm, so that the configured algorithm can change
+// without locking anyone out. Hashes use the PHC string format
+// ($argon2id$v=19$m=...,t=...,p=...$salt$hash) or, for bcrypt, bcrypt's own
+// $2a$<cost>$ format, which is what accounts created before argon2id have.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded. Accounts without a
+	// password, created through an external provider, never match.
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash reports whether encoded was made with another algorithm
+	// or other parameters than Hash would use now
+	NeedsRehash(encoded string) bool
+}
+
+var (
+	ErrUnknownPasswordHash = errors.New("unknown password hash format")
+	// ErrPasswordTooLong is returned by Hash when the algorithm cannot take
+	// the whole password
+	ErrPasswordTooLong = errors.New("password must be at most 72 bytes with the configured hash algorithm")
+)
+
+// Argon2Params are the argon2id cost parameters; Memory is in KiB
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+	// Hashes asking for more memory than this are refused rather than
+	// letting a bad row exhaust the server
+	argon2MaxMemory = 4 * 1024 * 1024
+)
+
+type argon2idHasher struct {
+	params Argon2Params
+}
+
+// NewArgon2idHasher - See RFC 9106 for choosing params; at least 19 MiB of
+// memory and 2 iterations is the common minimum.
+func NewArgon2idHasher(params Argon2Params) PasswordHasher {
+	return &argon2idHasher{params: params}
+}
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := h.params
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *argon2idHasher) Verify(password, encoded string) (bool, error) {
+	return verifyPassword(password, encoded)
+}
+
+func (h *argon2idHasher) NeedsRehash(encoded string) bool {
+	hash, err := parseArgon2id(encoded)
+	return err != nil || hash.params != h.params || len(hash.key) != argon2KeyLen
+}
+
+const bcryptMaxPasswordLen = 72
+
+type bcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher - bcrypt only looks at the first 72 bytes of a password,
+// so Hash refuses longer ones with ErrPasswordTooLong. Prefer argon2id.
+func NewBcryptHasher(cost int) PasswordHasher {
+	return &bcryptHasher{cost: cost}
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	if len(password) > bcryptMaxPasswordLen {
+		return "", ErrPasswordTooLong
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func (h *bcryptHasher) Verify(password, encoded string) (bool, error) {
+	return verifyPassword(password, encoded)
+}
+
+func (h *bcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.cost
+}
+
+// verifyPassword picks the algorithm from the hash itself
+func verifyPassword(password, encoded string) (bool, error) {
+	switch {
+	case encoded == "":
+		return false, nil
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		hash, err := parseArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+		p := hash.params
+		key := argon2.IDKey([]byte(password), hash.salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(hash.key)))
+		return subtle.ConstantTimeCompare(key, hash.key) == 1, nil
+	case strings.HasPrefix(encoded, "$2"):
+		// Only the first 72 bytes of the password are compared. Login
+		// replaces such hashes with argon2id, which has no such limit.
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	return false, ErrUnknownPasswordHash
+}
+
+type argon2idHash struct {
+	params Argon2Params
+	salt   []byte
+	key    []byte
+}
+
+func parseArgon2id(encoded string) (*argon2idHash, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return nil, ErrUnknownPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrUnknownPasswordHash
+	}
+	var memory, iterations, parallelism uint32
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism); err != nil {
+		return nil, ErrUnknownPasswordHash
+	}
+	if memory == 0 || memory > argon2MaxMemory || iterations == 0 || parallelism == 0 || parallelism > 255 {
+		return nil, ErrUnknownPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, ErrUnknownPasswordHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, ErrUnknownPasswordHash
+	}
+	return &argon2idHash{
+		params: Argon2Params{Memory: memory, Iterations: iterations, Parallelism: uint8(parallelism)},
+		salt:   salt,
+		key:    key,
+	}, nil
+}
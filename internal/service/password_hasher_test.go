@@ -0,0 +1,134 @@
+package service
+
+import (
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+// Cheap parameters; the format does not depend on the cost
+var testArgon2Params = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1}
+
+func TestPasswordHasherRoundTrip(t *testing.T) {
+	hashers := map[string]PasswordHasher{
+		"argon2id": NewArgon2idHasher(testArgon2Params),
+		"bcrypt":   NewBcryptHasher(bcrypt.MinCost),
+	}
+	for name, hasher := range hashers {
+		t.Run(name, func(t *testing.T) {
+			encoded, err := hasher.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			// Every hasher verifies the hashes of every algorithm
+			for otherName, other := range hashers {
+				if ok, err := other.Verify("correct horse", encoded); !ok || err != nil {
+					t.Errorf("%s Verify(right password) = %v, %v", otherName, ok, err)
+				}
+				if ok, err := other.Verify("wrong horse", encoded); ok || err != nil {
+					t.Errorf("%s Verify(wrong password) = %v, %v", otherName, ok, err)
+				}
+			}
+			if hasher.NeedsRehash(encoded) {
+				t.Errorf("NeedsRehash(%q) = true for a fresh hash", encoded)
+			}
+		})
+	}
+}
+
+func TestArgon2idHashFormat(t *testing.T) {
+	encoded, err := NewArgon2idHasher(testArgon2Params).Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("hash %q is not in PHC format", encoded)
+	}
+	other, _ := NewArgon2idHasher(testArgon2Params).Hash("password")
+	if other == encoded {
+		t.Error("two hashes of the same password share a salt")
+	}
+}
+
+func TestBcryptRefusesLongPasswords(t *testing.T) {
+	hasher := NewBcryptHasher(bcrypt.MinCost)
+	if _, err := hasher.Hash(strings.Repeat("a", 72)); err != nil {
+		t.Errorf("Hash of 72 bytes: %v", err)
+	}
+	if _, err := hasher.Hash(strings.Repeat("a", 73)); !errors.Is(err, ErrPasswordTooLong) {
+		t.Errorf("Hash of 73 bytes error = %v, want ErrPasswordTooLong", err)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	argon2Hash, _ := NewArgon2idHasher(testArgon2Params).Hash("password")
+	bcryptHash, _ := NewBcryptHasher(bcrypt.MinCost).Hash("password")
+	current := NewArgon2idHasher(testArgon2Params)
+
+	tests := []struct {
+		name    string
+		hasher  PasswordHasher
+		encoded string
+		want    bool
+	}{
+		{"same argon2id params", current, argon2Hash, false},
+		{"more argon2id memory", NewArgon2idHasher(Argon2Params{Memory: 128, Iterations: 1, Parallelism: 1}), argon2Hash, true},
+		{"more argon2id iterations", NewArgon2idHasher(Argon2Params{Memory: 64, Iterations: 2, Parallelism: 1}), argon2Hash, true},
+		{"bcrypt to argon2id", current, bcryptHash, true},
+		{"argon2id to bcrypt", NewBcryptHasher(bcrypt.MinCost), argon2Hash, true},
+		{"same bcrypt cost", NewBcryptHasher(bcrypt.MinCost), bcryptHash, false},
+		{"higher bcrypt cost", NewBcryptHasher(bcrypt.MinCost + 1), bcryptHash, true},
+		{"shorter argon2id key", current, "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5", true},
+		{"garbage", current, "not a hash", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.NeedsRehash(tt.encoded); got != tt.want {
+				t.Errorf("NeedsRehash(%q) = %v, want %v", tt.encoded, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArgon2id(t *testing.T) {
+	got, err := parseArgon2id("$argon2id$v=19$m=65536,t=3,p=2$c2FsdHNhbHQ$a2V5a2V5")
+	if err != nil {
+		t.Fatalf("parseArgon2id: %v", err)
+	}
+	if want := (Argon2Params{Memory: 65536, Iterations: 3, Parallelism: 2}); got.params != want {
+		t.Errorf("params = %+v, want %+v", got.params, want)
+	}
+	if string(got.salt) != "saltsalt" || string(got.key) != "keykey" {
+		t.Errorf("salt, key = %q, %q", got.salt, got.key)
+	}
+
+	invalid := []string{
+		"",
+		"$argon2i$v=19$m=65536,t=3,p=2$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=16$m=65536,t=3,p=2$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=65536,t=3$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=0,t=3,p=2$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=65536,t=0,p=2$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=65536,t=3,p=0$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=65536,t=3,p=256$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=99999999,t=3,p=2$c2FsdHNhbHQ$a2V5a2V5",
+		"$argon2id$v=19$m=65536,t=3,p=2$not*base64$a2V5a2V5",
+		"$argon2id$v=19$m=65536,t=3,p=2$c2FsdHNhbHQ$",
+		"$argon2id$v=19$m=65536,t=3,p=2$c2FsdHNhbHQ$a2V5a2V5$extra",
+	}
+	for _, encoded := range invalid {
+		if _, err := parseArgon2id(encoded); !errors.Is(err, ErrUnknownPasswordHash) {
+			t.Errorf("parseArgon2id(%q) error = %v, want ErrUnknownPasswordHash", encoded, err)
+		}
+	}
+}
+
+func TestVerifyPasswordWithoutHash(t *testing.T) {
+	if ok, err := verifyPassword("", ""); ok || err != nil {
+		t.Errorf("verifyPassword of an account without password = %v, %v", ok, err)
+	}
+	if _, err := verifyPassword("password", "$1$md5$hash"); !errors.Is(err, ErrUnknownPasswordHash) {
+		t.Errorf("verifyPassword of an unknown hash error = %v, want ErrUnknownPasswordHash", err)
+	}
+}
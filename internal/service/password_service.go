@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maxwellzp/blog-api/internal/mailer"
+	"maxwellzp/blog-api/internal/model"
+	"maxwellzp/blog-api/internal/repository"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type PasswordService interface {
+	ChangePassword(ctx context.Context, userID int64, currentPassword, newPassword string) error
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+}
+
+var (
+	ErrWrongPassword     = errors.New("current password is incorrect")
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+)
+
+type passwordService struct {
+	userRepo  repository.UserRepository
+	sessions  SessionService
+	hasher    PasswordHasher
+	resetRepo repository.PasswordResetRepository
+	mailer    mailer.Mailer
+	resetURL  string
+	resetTTL  time.Duration
+}
+
+func NewPasswordService(
+	userRepo repository.UserRepository,
+	sessions SessionService,
+	hasher PasswordHasher,
+	resetRepo repository.PasswordResetRepository,
+	mailer mailer.Mailer,
+	resetURL string,
+	resetTTL time.Duration,
+) PasswordService {
+	return &passwordService{
+		userRepo:  userRepo,
+		sessions:  sessions,
+		hasher:    hasher,
+		resetRepo: resetRepo,
+		mailer:    mailer,
+		resetURL:  resetURL,
+		resetTTL:  resetTTL,
+	}
+}
+
+func (s *passwordService) ChangePassword(ctx context.Context, userID int64, currentPassword, newPassword string) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	ok, err := s.hasher.Verify(currentPassword, user.Password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrWrongPassword
+	}
+	return s.setPassword(ctx, user.ID, newPassword)
+}
+
+// ForgotPassword mails a single-use reset link. Unknown emails are silently
+// ignored so that the endpoint cannot be used to find registered accounts;
+// the handler runs it after answering, as the email takes time.
+func (s *passwordService) ForgotPassword(ctx context.Context, email string) error {
+	email = strings.TrimSpace(strings.ToLower(email))
+	user, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	err = s.resetRepo.Create(ctx, &model.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.resetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link, err := withQuery(s.resetURL, "token", token)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone asked to reset the password of your account. If it was you, open\n"+
+			"the link below within %s to choose a new password:\n\n%s\n\n"+
+			"If you did not ask for this, you can ignore this email.\n",
+			user.Username, s.resetTTL, link),
+	})
+}
+
+func (s *passwordService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	stored, err := s.resetRepo.FindByHash(ctx, hashToken(token))
+	if err != nil {
+		return err
+	}
+	if stored == nil || stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+	// Hash before using up the token, so that a password the hasher refuses
+	// can be corrected and sent again
+	hashed, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	used, err := s.resetRepo.MarkUsed(ctx, stored.ID)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidResetToken
+	}
+
+	if err := s.storePassword(ctx, stored.UserID, hashed); err != nil {
+		return err
+	}
+	// Older links sent before this one must not work any more either
+	return s.resetRepo.InvalidateForUser(ctx, stored.UserID)
+}
+
+// setPassword stores the new password and logs the user out everywhere by
+// revoking all sessions.
+func (s *passwordService) setPassword(ctx context.Context, userID int64, password string) error {
+	hashed, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	return s.storePassword(ctx, userID, hashed)
+}
+
+// storePassword is setPassword for an already hashed password
+func (s *passwordService) storePassword(ctx context.Context, userID int64, hashed string) error {
+	if err := s.userRepo.UpdatePassword(ctx, userID, hashed); err != nil {
+		return err
+	}
+	return s.sessions.RevokeAllForUser(ctx, userID)
+}
+
+// withQuery adds a query parameter to a configured URL
+func withQuery(rawURL, key, value string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set(key, value)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"maxwellzp/blog-api/internal/model"
+	"maxwellzp/blog-api/internal/repository"
+	"slices"
+	"strings"
+	"time"
+)
+
+type PersonalAccessTokenService interface {
+	Create(ctx context.Context, userID int64, name string, scopes []model.Scope, expiresAt *time.Time) (*model.PersonalAccessToken, string, error)
+	List(ctx context.Context, userID int64) ([]*model.PersonalAccessToken, error)
+	Revoke(ctx context.Context, userID, id int64) error
+	RevokeAll(ctx context.Context, userID int64) error
+	Authenticate(ctx context.Context, token string) (*model.User, *model.PersonalAccessToken, error)
+}
+
+var (
+	ErrPersonalAccessTokenNotFound = errors.New("personal access token not found")
+	ErrInvalidPersonalAccessToken  = errors.New("invalid personal access token")
+)
+
+// How much of a token is kept in clear text to tell tokens apart
+const personalAccessTokenPrefixLen = 12
+
+type personalAccessTokenService struct {
+	repo     repository.PersonalAccessTokenRepository
+	userRepo repository.UserRepository
+}
+
+func NewPersonalAccessTokenService(
+	repo repository.PersonalAccessTokenRepository,
+	userRepo repository.UserRepository,
+) PersonalAccessTokenService {
+	return &personalAccessTokenService{repo: repo, userRepo: userRepo}
+}
+
+// Create returns the stored token together with its secret value, which is
+// not kept and cannot be shown again.
+func (s *personalAccessTokenService) Create(
+	ctx context.Context,
+	userID int64,
+	name string,
+	scopes []model.Scope,
+	expiresAt *time.Time,
+) (*model.PersonalAccessToken, string, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	plain := model.PersonalAccessTokenPrefix + secret
+
+	token := &model.PersonalAccessToken{
+		UserID:    userID,
+		Name:      strings.TrimSpace(name),
+		Prefix:    plain[:personalAccessTokenPrefixLen],
+		TokenHash: hashToken(plain),
+		Scopes:    uniqueScopes(scopes),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.repo.Create(ctx, token); err != nil {
+		return nil, "", err
+	}
+	return token, plain, nil
+}
+
+func (s *personalAccessTokenService) List(ctx context.Context, userID int64) ([]*model.PersonalAccessToken, error) {
+	return s.repo.ListByUserID(ctx, userID)
+}
+
+func (s *personalAccessTokenService) Revoke(ctx context.Context, userID, id int64) error {
+	revoked, err := s.repo.Revoke(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrPersonalAccessTokenNotFound
+	}
+	return nil
+}
+
+func (s *personalAccessTokenService) RevokeAll(ctx context.Context, userID int64) error {
+	return s.repo.RevokeAllForUser(ctx, userID)
+}
+
+// Authenticate resolves a token presented as a bearer token. The user is
+// loaded on every request so that role changes apply right away, and
+// accounts that are deleted or waiting for deletion are refused.
+func (s *personalAccessTokenService) Authenticate(ctx context.Context, plain string) (*model.User, *model.PersonalAccessToken, error) {
+	token, err := s.repo.FindByHash(ctx, hashToken(plain))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	if token == nil || token.RevokedAt != nil || (token.ExpiresAt != nil && now.After(*token.ExpiresAt)) {
+		return nil, nil, ErrInvalidPersonalAccessToken
+	}
+
+	user, err := s.userRepo.FindByID(ctx, token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil || user.Deleted() {
+		return nil, nil, ErrInvalidPersonalAccessToken
+	}
+
+	if err := s.repo.TouchLastUsed(ctx, token.ID, now); err != nil {
+		return nil, nil, err
+	}
+	return user, token, nil
+}
+
+func uniqueScopes(scopes []model.Scope) []model.Scope {
+	unique := make([]model.Scope, 0, len(scopes))
+	for _, scope := range scopes {
+		if !slices.Contains(unique, scope) {
+			unique = append(unique, scope)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"maxwellzp/blog-api/internal/helpers"
+	"maxwellzp/blog-api/internal/model"
+	"maxwellzp/blog-api/internal/repository"
+	"strings"
+	"unicode"
+)
+
+const snippetWidth = 160
+
+type SearchService interface {
+	Search(ctx context.Context, query string, limit, offset int) ([]*model.SearchResult, error)
+}
+
+type searchService struct {
+	repo repository.SearchRepository
+}
+
+func NewSearchService(repo repository.SearchRepository) SearchService {
+	return &searchService{repo: repo}
+}
+
+func (s *searchService) Search(ctx context.Context, query string, limit, offset int) ([]*model.SearchResult, error) {
+	query = strings.TrimSpace(query)
+	results, err := s.repo.Search(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	terms := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, res := range results {
+		res.Snippet = helpers.Highlight(res.Content, terms, snippetWidth)
+	}
+	return results, nil
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"maxwellzp/blog-api/internal/model"
+	"maxwellzp/blog-api/internal/repository"
+	"sync"
+	"time"
+)
+
+type SessionService interface {
+	Start(ctx context.Context, userID int64, familyID string, client ClientInfo) (*model.Session, error)
+	Resume(ctx context.Context, userID int64, familyID string, client ClientInfo) (*model.Session, error)
+	List(ctx context.Context, userID, currentID int64) ([]*model.Session, error)
+	Revoke(ctx context.Context, userID, id int64) error
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeAllForUser(ctx context.Context, userID int64) error
+	IsActive(ctx context.Context, id int64) (bool, error)
+}
+
+// ClientInfo describes the device a login comes from
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionRevoked  = errors.New("session has been revoked")
+)
+
+const (
+	maxUserAgentLength = 255
+	// Expired cache entries are only swept once the cache grows past this
+	sessionCacheSweepSize = 10000
+)
+
+type sessionCacheEntry struct {
+	userID  int64
+	active  bool
+	expires time.Time
+}
+
+type sessionService struct {
+	repo        repository.SessionRepository
+	refreshRepo repository.RefreshTokenRepository
+	// A session ends when its refresh tokens do
+	refreshTokenTTL time.Duration
+	cacheTTL        time.Duration
+
+	mu    sync.Mutex
+	cache map[int64]sessionCacheEntry
+}
+
+// NewSessionService - IsActive results are cached for cacheTTL. Revocations
+// through this service apply at once on this instance; other instances
+// notice them within cacheTTL.
+func NewSessionService(
+	repo repository.SessionRepository,
+	refreshRepo repository.RefreshTokenRepository,
+	refreshTokenTTL time.Duration,
+	cacheTTL time.Duration,
+) SessionService {
+	return &sessionService{
+		repo:            repo,
+		refreshRepo:     refreshRepo,
+		refreshTokenTTL: refreshTokenTTL,
+		cacheTTL:        cacheTTL,
+		cache:           make(map[int64]sessionCacheEntry),
+	}
+}
+
+func (s *sessionService) Start(ctx context.Context, userID int64, familyID string, client ClientInfo) (*model.Session, error) {
+	session := &model.Session{
+		UserID:     userID,
+		FamilyID:   familyID,
+		UserAgent:  truncateRunes(client.UserAgent, maxUserAgentLength),
+		IP:         client.IP,
+		LastSeenAt: time.Now(),
+	}
+	if err := s.repo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Resume returns the session of a refresh token family. Families started
+// before sessions existed get one on their next refresh.
+func (s *sessionService) Resume(ctx context.Context, userID int64, familyID string, client ClientInfo) (*model.Session, error) {
+	session, err := s.repo.FindByFamilyID(ctx, familyID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return s.Start(ctx, userID, familyID, client)
+	}
+	if session.RevokedAt != nil {
+		return nil, ErrSessionRevoked
+	}
+
+	session.LastSeenAt = time.Now()
+	if err := s.repo.TouchLastSeen(ctx, session.ID, session.LastSeenAt); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *sessionService) List(ctx context.Context, userID, currentID int64) ([]*model.Session, error) {
+	sessions, err := s.repo.ListActiveByUserID(ctx, userID, time.Now().Add(-s.refreshTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		session.Current = session.ID == currentID
+	}
+	return sessions, nil
+}
+
+// Revoke signs a device out: its refresh tokens stop working and so do the
+// access tokens already issued to it.
+func (s *sessionService) Revoke(ctx context.Context, userID, id int64) error {
+	session, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if session == nil || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	revoked, err := s.repo.Revoke(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrSessionNotFound
+	}
+	s.markRevoked(func(sessionID int64, _ sessionCacheEntry) bool { return sessionID == id })
+	return s.refreshRepo.RevokeFamily(ctx, session.FamilyID)
+}
+
+func (s *sessionService) RevokeFamily(ctx context.Context, familyID string) error {
+	if err := s.refreshRepo.RevokeFamily(ctx, familyID); err != nil {
+		return err
+	}
+	session, err := s.repo.FindByFamilyID(ctx, familyID)
+	if err != nil || session == nil {
+		return err
+	}
+	if _, err := s.repo.Revoke(ctx, session.ID, session.UserID); err != nil {
+		return err
+	}
+	s.markRevoked(func(sessionID int64, _ sessionCacheEntry) bool { return sessionID == session.ID })
+	return nil
+}
+
+func (s *sessionService) RevokeAllForUser(ctx context.Context, userID int64) error {
+	if err := s.refreshRepo.RevokeAllForUser(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.repo.RevokeAllForUser(ctx, userID); err != nil {
+		return err
+	}
+	s.markRevoked(func(_ int64, entry sessionCacheEntry) bool { return entry.userID == userID })
+	return nil
+}
+
+// IsActive is called for every authenticated request. Cache misses also
+// refresh the session's last seen time.
+func (s *sessionService) IsActive(ctx context.Context, id int64) (bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	entry, ok := s.cache[id]
+	s.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.active, nil
+	}
+
+	session, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	entry = sessionCacheEntry{active: session != nil && session.RevokedAt == nil, expires: now.Add(s.cacheTTL)}
+	if session != nil {
+		entry.userID = session.UserID
+	}
+	if entry.active {
+		if err := s.repo.TouchLastSeen(ctx, id, now); err != nil {
+			return false, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.cache) >= sessionCacheSweepSize {
+		for cachedID, cached := range s.cache {
+			if now.After(cached.expires) {
+				delete(s.cache, cachedID)
+			}
+		}
+	}
+	s.cache[id] = entry
+	return entry.active, nil
+}
+
+// markRevoked marks the matching cached sessions as revoked
+func (s *sessionService) markRevoked(match func(id int64, entry sessionCacheEntry) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, entry := range s.cache {
+		if match(id, entry) {
+			entry.active = false
+			s.cache[id] = entry
+		}
+	}
+}
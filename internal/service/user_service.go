@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"maxwellzp/blog-api/internal/model"
+	"maxwellzp/blog-api/internal/repository"
+	"strings"
+)
+
+type UserService interface {
+	GetByID(ctx context.Context, id int64) (*model.User, error)
+	UpdateProfile(ctx context.Context, id int64, input ProfileInput) (*model.User, error)
+	UpdateRole(ctx context.Context, id int64, role model.Role) error
+}
+
+// ProfileInput holds a partial profile update. nil fields are left unchanged.
+type ProfileInput struct {
+	DisplayName *string
+	Bio         *string
+	AvatarURL   *string
+}
+
+var ErrUserNotFound = errors.New("user not found")
+
+type userService struct {
+	repo repository.UserRepository
+}
+
+func NewUserService(repo repository.UserRepository) UserService {
+	return &userService{repo: repo}
+}
+
+func (s *userService) GetByID(ctx context.Context, id int64) (*model.User, error) {
+	user, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *userService) UpdateProfile(ctx context.Context, id int64, input ProfileInput) (*model.User, error) {
+	user, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.DisplayName != nil {
+		user.DisplayName = strings.TrimSpace(*input.DisplayName)
+	}
+	if input.Bio != nil {
+		user.Bio = strings.TrimSpace(*input.Bio)
+	}
+	if input.AvatarURL != nil {
+		user.AvatarURL = strings.TrimSpace(*input.AvatarURL)
+	}
+
+	if err := s.repo.UpdateProfile(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *userService) UpdateRole(ctx context.Context, id int64, role model.Role) error {
+	if _, err := s.GetByID(ctx, id); err != nil {
+		return err
+	}
+	return s.repo.UpdateRole(ctx, id, role)
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maxwellzp/blog-api/internal/mailer"
+	"maxwellzp/blog-api/internal/model"
+	"maxwellzp/blog-api/internal/repository"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type VerificationService interface {
+	SendVerification(ctx context.Context, user *model.User) error
+	Resend(ctx context.Context, userID int64) error
+	Verify(ctx context.Context, token string) error
+}
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	ErrEmailAlreadyVerified     = errors.New("email is already verified")
+)
+
+type verificationService struct {
+	userRepo  repository.UserRepository
+	mailer    mailer.Mailer
+	key       []byte
+	verifyURL string
+	ttl       time.Duration
+}
+
+// NewVerificationService signs links with a key derived from secret, so a
+// verification token can never pass as an access token or the other way round.
+func NewVerificationService(
+	userRepo repository.UserRepository,
+	mailer mailer.Mailer,
+	secret string,
+	verifyURL string,
+	ttl time.Duration,
+) VerificationService {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("email-verification"))
+	return &verificationService{
+		userRepo:  userRepo,
+		mailer:    mailer,
+		key:       mac.Sum(nil),
+		verifyURL: verifyURL,
+		ttl:       ttl,
+	}
+}
+
+func (s *verificationService) SendVerification(ctx context.Context, user *model.User) error {
+	if user.EmailVerified() {
+		return ErrEmailAlreadyVerified
+	}
+
+	link, err := withQuery(s.verifyURL, "token", s.sign(user.ID, user.Email, time.Now().Add(s.ttl)))
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Please confirm your email address by opening the link below within %s:\n\n%s\n\n"+
+			"If you did not create an account, you can ignore this email.\n",
+			user.Username, s.ttl, link),
+	})
+}
+
+func (s *verificationService) Resend(ctx context.Context, userID int64) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	return s.SendVerification(ctx, user)
+}
+
+// Verify is idempotent: following the same link twice is not an error
+func (s *verificationService) Verify(ctx context.Context, token string) error {
+	userID, email, err := s.parse(token)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.Email != email {
+		return ErrInvalidVerificationToken
+	}
+	if user.EmailVerified() {
+		return nil
+	}
+
+	updated, err := s.userRepo.MarkEmailVerified(ctx, userID, email, time.Now())
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrInvalidVerificationToken
+	}
+	return nil
+}
+
+// sign builds a stateless token "<payload>.<mac>" where the payload is
+// "<user id>:<expiry unix>:<email>", both parts base64url encoded.
+func (s *verificationService) sign(userID int64, email string, expires time.Time) string {
+	payload := []byte(strconv.FormatInt(userID, 10) + ":" + strconv.FormatInt(expires.Unix(), 10) + ":" + email)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(s.mac(payload))
+}
+
+func (s *verificationService) parse(token string) (int64, string, error) {
+	rawPayload, rawMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, "", ErrInvalidVerificationToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(rawPayload)
+	if err != nil {
+		return 0, "", ErrInvalidVerificationToken
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(rawMAC)
+	if err != nil || !hmac.Equal(sum, s.mac(payload)) {
+		return 0, "", ErrInvalidVerificationToken
+	}
+
+	// The email goes last because it is the only part that may contain ":"
+	parts := strings.SplitN(string(payload), ":", 3)
+	if len(parts) != 3 {
+		return 0, "", ErrInvalidVerificationToken
+	}
+	userID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", ErrInvalidVerificationToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return 0, "", ErrInvalidVerificationToken
+	}
+	return userID, parts[2], nil
+}
+
+func (s *verificationService) mac(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -69,6 +69,8 @@ func validationMessage(fe validator.FieldError) string {
 		msg = fmt.Sprintf("%s must be at least %s characters", fe.Field(), fe.Param())
 	case "max":
 		msg = fmt.Sprintf("%s must be at most %s characters", fe.Field(), fe.Param())
+	case "oneof":
+		msg = fmt.Sprintf("%s must be one of: %s", fe.Field(), fe.Param())
 	case "containsuppercase":
 		msg = fmt.Sprintf("%s must contain at least one uppercase letter", fe.Field())
 	case "containslowercase":
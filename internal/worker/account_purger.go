@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"maxwellzp/blog-api/internal/service"
+	"time"
+)
+
+// AccountPurger carries out account deletions once their grace period is over
+type AccountPurger struct {
+	accountService service.AccountService
+	interval       time.Duration
+	logger         *zap.SugaredLogger
+}
+
+func NewAccountPurger(accountService service.AccountService, interval time.Duration, logger *zap.SugaredLogger) *AccountPurger {
+	return &AccountPurger{accountService: accountService, interval: interval, logger: logger}
+}
+
+func (p *AccountPurger) Run(ctx context.Context) {
+	every(ctx, p.interval, "account_purger", p.logger, p.purge)
+}
+
+func (p *AccountPurger) purge(ctx context.Context) error {
+	purged, err := p.accountService.PurgeDue(ctx)
+	if purged > 0 {
+		p.logger.Infow("Purged deleted accounts",
+			"user_count", purged,
+		)
+	}
+	return err
+}
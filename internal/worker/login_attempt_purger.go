@@ -0,0 +1,38 @@
+package worker
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"maxwellzp/blog-api/internal/service"
+	"time"
+)
+
+// LoginAttemptPurger deletes failed login records once they are outside the
+// lockout policy's failure window, so that credential stuffing with made-up
+// emails does not grow the table forever.
+type LoginAttemptPurger struct {
+	authService service.AuthService
+	interval    time.Duration
+	logger      *zap.SugaredLogger
+}
+
+func NewLoginAttemptPurger(authService service.AuthService, interval time.Duration, logger *zap.SugaredLogger) *LoginAttemptPurger {
+	return &LoginAttemptPurger{authService: authService, interval: interval, logger: logger}
+}
+
+func (p *LoginAttemptPurger) Run(ctx context.Context) {
+	every(ctx, p.interval, "login_attempt_purger", p.logger, p.purge)
+}
+
+func (p *LoginAttemptPurger) purge(ctx context.Context) error {
+	purged, err := p.authService.PurgeLoginAttempts(ctx)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		p.logger.Infow("Purged stale login attempts",
+			"attempt_count", purged,
+		)
+	}
+	return nil
+}
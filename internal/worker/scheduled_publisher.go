@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"maxwellzp/blog-api/internal/service"
+	"time"
+)
+
+// ScheduledPublisher publishes blogs once their publish_at time has passed
+type ScheduledPublisher struct {
+	blogService service.BlogService
+	interval    time.Duration
+	logger      *zap.SugaredLogger
+}
+
+func NewScheduledPublisher(blogService service.BlogService, interval time.Duration, logger *zap.SugaredLogger) *ScheduledPublisher {
+	return &ScheduledPublisher{blogService: blogService, interval: interval, logger: logger}
+}
+
+func (p *ScheduledPublisher) Run(ctx context.Context) {
+	every(ctx, p.interval, "scheduled_publisher", p.logger, p.publishDue)
+}
+
+func (p *ScheduledPublisher) publishDue(ctx context.Context) error {
+	published, err := p.blogService.PublishDue(ctx)
+	if err != nil {
+		return err
+	}
+	if published > 0 {
+		p.logger.Infow("Published scheduled blogs",
+			"blog_count", published,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package worker
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"maxwellzp/blog-api/internal/service"
+	"time"
+)
+
+// TrashPurger hard-deletes blogs once they have been in the trash for longer
+// than the retention period.
+type TrashPurger struct {
+	blogService service.BlogService
+	retention   time.Duration
+	interval    time.Duration
+	logger      *zap.SugaredLogger
+}
+
+func NewTrashPurger(blogService service.BlogService, retention, interval time.Duration, logger *zap.SugaredLogger) *TrashPurger {
+	return &TrashPurger{blogService: blogService, retention: retention, interval: interval, logger: logger}
+}
+
+func (p *TrashPurger) Run(ctx context.Context) {
+	every(ctx, p.interval, "trash_purger", p.logger, p.purge)
+}
+
+func (p *TrashPurger) purge(ctx context.Context) error {
+	purged, err := p.blogService.PurgeTrash(ctx, p.retention)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		p.logger.Infow("Purged blogs from trash",
+			"blog_count", purged,
+			"retention", p.retention.String(),
+		)
+	}
+	return nil
+}
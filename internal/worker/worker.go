@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Worker is a background job started by the server and stopped by
+// cancelling the context passed to Run.
+type Worker interface {
+	Run(ctx context.Context)
+}
+
+// every calls fn once per interval until ctx is cancelled. A failed run is
+// logged and retried on the next tick.
+func every(ctx context.Context, interval time.Duration, name string, logger *zap.SugaredLogger, fn func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	logger.Infow("worker started", "worker", name, "interval", interval.String())
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Infow("worker stopped", "worker", name)
+			return
+		case <-ticker.C:
+			if err := fn(ctx); err != nil && ctx.Err() == nil {
+				logger.Errorw("worker run failed",
+					"worker", name,
+					"error", err,
+				)
+			}
+		}
+	}
+}
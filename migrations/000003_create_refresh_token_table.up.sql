@@ -0,0 +1,12 @@
+CREATE TABLE refresh_token
+(
+    id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id    BIGINT      NOT NULL,
+    family_id  VARCHAR(64) NOT NULL,
+    token_hash CHAR(64)    NOT NULL UNIQUE,
+    expires_at DATETIME    NOT NULL,
+    revoked_at DATETIME    NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_refresh_token_family (family_id),
+    FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+DROP INDEX idx_blog_status ON blog;
+ALTER TABLE blog DROP COLUMN published_at, DROP COLUMN status;
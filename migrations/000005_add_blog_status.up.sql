@@ -0,0 +1,8 @@
+ALTER TABLE blog
+    ADD COLUMN status       VARCHAR(20) NOT NULL DEFAULT 'draft',
+    ADD COLUMN published_at DATETIME    NULL;
+
+-- Everything written before this migration was already public
+UPDATE blog SET status = 'published', published_at = created_at;
+
+CREATE INDEX idx_blog_status ON blog (status);
@@ -0,0 +1,3 @@
+DROP INDEX idx_blog_status_publish_at ON blog;
+UPDATE blog SET status = 'draft' WHERE status = 'scheduled';
+ALTER TABLE blog DROP COLUMN publish_at;
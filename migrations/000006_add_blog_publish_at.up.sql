@@ -0,0 +1,3 @@
+ALTER TABLE blog ADD COLUMN publish_at DATETIME NULL;
+
+CREATE INDEX idx_blog_status_publish_at ON blog (status, publish_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS blog_tag;
+DROP TABLE IF EXISTS tag;
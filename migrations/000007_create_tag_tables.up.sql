@@ -0,0 +1,16 @@
+CREATE TABLE tag
+(
+    id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+    name       VARCHAR(50) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE blog_tag
+(
+    blog_id BIGINT NOT NULL,
+    tag_id  BIGINT NOT NULL,
+    PRIMARY KEY (blog_id, tag_id),
+    INDEX idx_blog_tag_tag (tag_id),
+    FOREIGN KEY (blog_id) REFERENCES blog (id) ON DELETE CASCADE,
+    FOREIGN KEY (tag_id) REFERENCES tag (id) ON DELETE CASCADE
+);
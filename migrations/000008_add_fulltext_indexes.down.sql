@@ -0,0 +1,2 @@
+DROP INDEX ft_comment_content ON comment;
+DROP INDEX ft_blog_title_content ON blog;
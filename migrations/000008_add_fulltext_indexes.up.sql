@@ -0,0 +1,2 @@
+CREATE FULLTEXT INDEX ft_blog_title_content ON blog (title, content);
+CREATE FULLTEXT INDEX ft_comment_content ON comment (content);
@@ -0,0 +1,2 @@
+ALTER TABLE comment DROP FOREIGN KEY fk_comment_parent;
+ALTER TABLE comment DROP COLUMN parent_id;
@@ -0,0 +1,3 @@
+ALTER TABLE comment
+    ADD COLUMN parent_id BIGINT NULL,
+    ADD CONSTRAINT fk_comment_parent FOREIGN KEY (parent_id) REFERENCES comment (id) ON DELETE CASCADE;
@@ -0,0 +1,18 @@
+CREATE TABLE blog_revision
+(
+    id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+    blog_id    BIGINT       NOT NULL,
+    revision   INT          NOT NULL,
+    user_id    BIGINT       NOT NULL,
+    title      VARCHAR(255) NOT NULL,
+    content    TEXT         NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_blog_revision (blog_id, revision),
+    FOREIGN KEY (blog_id) REFERENCES blog (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+);
+
+-- The current state of every existing blog becomes its first revision
+INSERT INTO blog_revision (blog_id, revision, user_id, title, content, created_at)
+SELECT id, 1, user_id, title, content, created_at
+FROM blog;
@@ -0,0 +1,2 @@
+ALTER TABLE blog ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE comment ADD COLUMN version INT NOT NULL DEFAULT 1;
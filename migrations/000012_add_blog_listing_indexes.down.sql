@@ -0,0 +1,2 @@
+DROP INDEX idx_blog_title ON blog;
+DROP INDEX idx_blog_created_at ON blog;
@@ -0,0 +1,2 @@
+CREATE INDEX idx_blog_created_at ON blog (created_at);
+CREATE INDEX idx_blog_title ON blog (title);
@@ -0,0 +1,4 @@
+ALTER TABLE user
+    ADD COLUMN display_name VARCHAR(100)  NOT NULL DEFAULT '',
+    ADD COLUMN bio          VARCHAR(1000) NOT NULL DEFAULT '',
+    ADD COLUMN avatar_url   VARCHAR(2048) NOT NULL DEFAULT '';
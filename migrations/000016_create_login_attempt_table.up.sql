@@ -0,0 +1,7 @@
+CREATE TABLE login_attempt
+(
+    email          VARCHAR(255) PRIMARY KEY,
+    failed_count   INT          NOT NULL DEFAULT 0,
+    last_failed_at DATETIME     NOT NULL,
+    locked_until   DATETIME     NULL
+);
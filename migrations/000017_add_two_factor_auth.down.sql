@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS recovery_code;
+
+ALTER TABLE user
+    DROP COLUMN totp_last_step,
+    DROP COLUMN totp_enabled_at,
+    DROP COLUMN totp_secret;
@@ -0,0 +1,15 @@
+ALTER TABLE user
+    ADD COLUMN totp_secret     VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN totp_enabled_at DATETIME    NULL,
+    ADD COLUMN totp_last_step  BIGINT      NOT NULL DEFAULT 0;
+
+CREATE TABLE recovery_code
+(
+    id         BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id    BIGINT   NOT NULL,
+    code_hash  CHAR(64) NOT NULL,
+    used_at    DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_recovery_code (user_id, code_hash),
+    FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+CREATE TABLE user_session
+(
+    id           BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id      BIGINT       NOT NULL,
+    family_id    VARCHAR(64)  NOT NULL UNIQUE,
+    user_agent   VARCHAR(255) NOT NULL,
+    ip           VARCHAR(45)  NOT NULL,
+    created_at   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at DATETIME     NOT NULL,
+    revoked_at   DATETIME     NULL,
+    INDEX idx_user_session_user (user_id, last_seen_at),
+    FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE
+);
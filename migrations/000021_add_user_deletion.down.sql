@@ -0,0 +1,4 @@
+ALTER TABLE user
+    DROP INDEX idx_user_deletion_scheduled_at,
+    DROP COLUMN deleted_at,
+    DROP COLUMN deletion_scheduled_at;
@@ -0,0 +1,4 @@
+ALTER TABLE user
+    ADD COLUMN deletion_scheduled_at DATETIME NULL,
+    ADD COLUMN deleted_at            DATETIME NULL,
+    ADD INDEX idx_user_deletion_scheduled_at (deletion_scheduled_at);
@@ -0,0 +1,3 @@
+ALTER TABLE comment DROP FOREIGN KEY fk_comment_parent;
+ALTER TABLE comment
+    ADD CONSTRAINT fk_comment_parent FOREIGN KEY (parent_id) REFERENCES comment (id) ON DELETE CASCADE;
@@ -0,0 +1,6 @@
+-- Deleting a comment keeps the replies of other users, which become top-level
+-- comments. It also keeps cascading blog and user deletes from running into
+-- InnoDB's limit of 15 nested cascades on deep threads.
+ALTER TABLE comment DROP FOREIGN KEY fk_comment_parent;
+ALTER TABLE comment
+    ADD CONSTRAINT fk_comment_parent FOREIGN KEY (parent_id) REFERENCES comment (id) ON DELETE SET NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE blog_revision DROP FOREIGN KEY fk_blog_revision_user;
+DELETE FROM blog_revision WHERE user_id IS NULL;
+ALTER TABLE blog_revision MODIFY user_id BIGINT NOT NULL;
+ALTER TABLE blog_revision
+    ADD CONSTRAINT blog_revision_ibfk_2 FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE;
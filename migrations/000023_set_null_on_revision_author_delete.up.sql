@@ -0,0 +1,6 @@
+-- Revisions a deleted user made on other users' blogs stay in the history
+-- without an author
+ALTER TABLE blog_revision DROP FOREIGN KEY blog_revision_ibfk_2;
+ALTER TABLE blog_revision MODIFY user_id BIGINT NULL;
+ALTER TABLE blog_revision
+    ADD CONSTRAINT fk_blog_revision_user FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE SET NULL;
@@ -0,0 +1 @@
+DROP INDEX idx_login_attempt_last_failed_at ON login_attempt;
@@ -0,0 +1,2 @@
+-- Lets the purge of stale failures skip the rows that still count
+CREATE INDEX idx_login_attempt_last_failed_at ON login_attempt (last_failed_at);